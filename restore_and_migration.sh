@@ -44,25 +44,24 @@ else
     echo "リストアに成功しました。"
 fi
 
-next="0"
-migrationDir="./mysql/migration"
-
-
+# mysql/migration内のファイルをバックエンドのマイグレーション機能で適用する
+# 適用済みのファイルはschema_migrationsテーブルに記録される
 echo "MySQLのマイグレーションを開始します。"
-while :
-do
-    fileName=$(cd $migrationDir && ls ${next}_*.sql 2>/dev/null)
-    if [ ! $fileName ]; then
-        echo "マイグレーションに成功しました。"
-        break
-    fi
-
-    echo "${fileName}を適用します..."
-    docker exec tuning-mysql bash -c "mysql -u root -pmysql 42Tokyo2508-db < /etc/mysql/migration/${fileName}"
-    next=$(($next + 1))
-done
+if [[ $HOSTNAME == ftt2508-* ]]; then
+    HOSTNAME=$HOSTNAME docker compose run --rm --no-deps backend migrate up
+else
+    docker compose -f docker-compose.local.yml run --rm --no-deps backend migrate up
+fi
 
 if [ $? -ne 0 ]; then
     echo "リストアとマイグレーションに失敗しました。"
     exit 1
 fi
+echo "マイグレーションに成功しました。"
+
+# リストア中にバックエンドが起動時のスキーマ確認で停止していた場合に備えて起動し直す
+if [[ $HOSTNAME == ftt2508-* ]]; then
+    HOSTNAME=$HOSTNAME docker compose up -d backend
+else
+    docker compose -f docker-compose.local.yml up -d backend
+fi
@@ -1,26 +1,96 @@
 package main
 
 import (
+	"backend/internal/config"
+	"backend/internal/logging"
 	"backend/internal/server"
-	"log"
+	"backend/internal/telemetry"
 	"context"
-   	"backend/internal/telemetry"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("backend exited with error", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// log.Fatalfだとdeferが実行されずテレメトリがフラッシュされないため、
+// 終了処理はrunの中で完結させる
+func run() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// レベルはLoad時に検証済み
+	level, _ := cfg.Log.SlogLevel()
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+	logger.Info("loaded config", slog.String("config", cfg.String()))
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return runMigrate(cfg, logger, os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		return runUser(cfg, logger, os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "webhook-receiver" {
+		return runWebhookReceiver(logger, os.Args[2:])
+	}
+
+	// 一部のシグナルの設定に失敗しても、設定できたものは使って続行する
 	shutdown, err := telemetry.Init(context.Background())
-   	if err != nil {
-   	   log.Printf("telemetry init failed: %v, continuing without telemetry", err)
-   	} else {
-   	   defer func() { _ = shutdown(context.Background()) }()
-   	}
-	srv, dbConn, err := server.NewServer()
 	if err != nil {
-		log.Fatalf("Failed to initialize server: %v", err)
+		logger.Warn("telemetry init failed, continuing with the signals that could be configured", slog.Any("error", err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Error("telemetry shutdown failed", slog.Any("error", err))
+		}
+	}()
+	// OTLPへのログ送信が有効な場合は標準出力と両方に出す
+	if h := telemetry.LogHandler(); h != nil {
+		logger = logging.New(os.Stdout, level, h)
+		slog.SetDefault(logger)
+	}
+
+	srv, err := server.NewServer(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize server: %w", err)
 	}
-	if dbConn != nil {
-		defer dbConn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Run() }()
+
+	select {
+	case err := <-errCh:
+		// 起動失敗時もDB・Redisは閉じておく
+		_ = srv.Shutdown(context.Background())
+		return err
+	case <-ctx.Done():
 	}
+	stop()
 
-	srv.Run()
+	timeout := cfg.Server.ShutdownTimeout
+	logger.Info("shutting down server", slog.Duration("timeout", timeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+	logger.Info("server stopped gracefully")
+	return nil
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/migration"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    roll back the last N migrations (default 1)
+  status      show applied and pending migrations`
+
+// server migrate サブコマンド
+func runMigrate(cfg *config.Config, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	dbConn, err := db.InitDBConnection(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	migrator := migration.New(dbConn.DB, os.DirFS(cfg.Migration.Dir), cfg.Migration.LockTimeout, logger)
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info("migrations applied", slog.Int("count", n))
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("migrate down: %q is not a positive number", args[1])
+			}
+		}
+		n, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Info("migrations rolled back", slog.Int("count", n))
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+	}
+	return fmt.Errorf("migrate: unknown command %q\n%s", args[0], migrateUsage)
+}
+
+func printStatus(statuses []migration.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS\tAPPLIED AT")
+	for _, st := range statuses {
+		status, appliedAt := "pending", "-"
+		if st.AppliedAt != nil {
+			status, appliedAt = "applied", st.AppliedAt.Format(time.DateTime)
+		}
+		switch {
+		case st.Missing:
+			status = "applied (file missing)"
+		case st.Modified:
+			status = "applied (modified)"
+		}
+		fmt.Fprintf(w, "%d_%s.sql\t%s\t%s\n", st.Version, st.Name, status, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+)
+
+const userUsage = `usage: server user <command>
+
+commands:
+  set-role <user_name> <role>   change the role of a user (store_manager, admin, operator)`
+
+// server user サブコマンド
+//
+// ユーザーの作成・ロールの変更はAPIでは管理者のみが行えるが、マイグレーション6で
+// 既存のユーザーは全て店舗管理者になるため、最初の管理者はこのコマンドで設定する。
+// セッションのロールはキャッシュされるため、変更は対象のユーザーがログインし直した後に反映される
+func runUser(cfg *config.Config, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	dbConn, err := db.InitDBConnection(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	store := repository.NewStore(dbConn, nil)
+	switch args[0] {
+	case "set-role":
+		if len(args) != 3 {
+			return errors.New(userUsage)
+		}
+		userName, role := args[1], args[2]
+		if !model.IsValidRole(role) {
+			return fmt.Errorf("user set-role: unknown role %q\n%s", role, userUsage)
+		}
+		user, err := store.UserRepo.FindByUserName(ctx, userName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user set-role: user %q not found", userName)
+		}
+		if err != nil {
+			return err
+		}
+		if err := store.UserRepo.UpdateRole(ctx, user.UserID, role); err != nil {
+			return err
+		}
+		logger.Info("user role changed",
+			slog.Int("user_id", user.UserID), slog.String("from", user.Role), slog.String("to", role))
+		return nil
+	}
+	return fmt.Errorf("user: unknown command %q\n%s", args[0], userUsage)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"backend/internal/webhook"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 署名のタイムスタンプの許容範囲
+const receiverSignatureTolerance = 5 * time.Minute
+
+// server webhook-receiver サブコマンド
+//
+// Webhookの送信をローカルで確認するための受信サーバー。署名を検証してイベントをログに出す。
+// バックエンドはWEBHOOK_ALLOW_PRIVATE_TARGETS=trueで起動し、http://localhost:9000/ などを登録する。
+// -statusで任意のステータスを返せるため、再試行やdeadへの移行も確認できる
+func runWebhookReceiver(logger *slog.Logger, args []string) error {
+	fs := flag.NewFlagSet("webhook-receiver", flag.ContinueOnError)
+	addr := fs.String("addr", ":9000", "listen address")
+	secret := fs.String("secret", "", "webhook secret (whsec_...); signatures are not verified if empty")
+	status := fs.Int("status", http.StatusNoContent, "status code to respond with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *secret == "" {
+		logger.Warn("no secret given, signatures are not verified")
+	}
+
+	// 再送で同じイベントが届いた場合に分かるよう、受信済みのイベントIDを覚えておく
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, "failed to read body", http.StatusBadRequest)
+				return
+			}
+			if *secret != "" {
+				err := webhook.Verify(*secret, r.Header.Get(webhook.HeaderSignature), body, time.Now(), receiverSignatureTolerance)
+				if err != nil {
+					logger.Warn("rejected webhook", slog.String("event", r.Header.Get(webhook.HeaderEvent)), slog.Any("error", err))
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+			}
+
+			eventID := r.Header.Get(webhook.HeaderDelivery)
+			mu.Lock()
+			duplicate := seen[eventID]
+			seen[eventID] = true
+			mu.Unlock()
+
+			logger.Info("received webhook",
+				slog.String("event", r.Header.Get(webhook.HeaderEvent)),
+				slog.String("event_id", eventID),
+				slog.Bool("duplicate", duplicate),
+				slog.String("body", string(body)),
+				slog.Int("status", *status))
+			w.WriteHeader(*status)
+		}),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("webhook receiver listening", slog.String("addr", *addr))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// APIのエラーレスポンス
+//
+// 全てのエラーを model.ErrorResponse のJSONで返す。クライアントはmessageではなく
+// codeで判定すること。messageはAccept-Languageに応じて日本語か英語で返す。
+package apierror
+
+import (
+	"backend/internal/logging"
+	"backend/internal/model"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// エラーコード
+const (
+	// リクエストの形式
+	CodeInvalidJSON      = "invalid_json"
+	CodeUnknownField     = "unknown_field"
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidCursor    = "invalid_cursor"
+	CodeBodyTooLarge     = "body_too_large"
+
+	// 認証・認可
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidAPIToken    = "invalid_api_token"
+	CodeInvalidAPIKey      = "invalid_api_key"
+	CodeInvalidCSRFToken   = "invalid_csrf_token"
+	CodeForbidden          = "forbidden"
+	CodeInsufficientScope  = "insufficient_scope"
+	CodeSessionRequired    = "session_required"
+
+	// リソース
+	CodeNotFound                 = "not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeUserNotFound             = "user_not_found"
+	CodeUserAlreadyExists        = "user_already_exists"
+	CodeOrderNotFound            = "order_not_found"
+	CodeImageNotFound            = "image_not_found"
+	CodeAPITokenNotFound         = "api_token_not_found"
+	CodeWebhookNotFound          = "webhook_not_found"
+	CodeDeliveryNotRedeliverable = "delivery_not_redeliverable"
+
+	// サーバーの状態
+	CodeTooManyExports     = "too_many_exports"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeTimeout            = "timeout"
+	CodeInternal           = "internal_error"
+)
+
+// メッセージの言語
+const (
+	LangJA = "ja"
+	LangEN = "en"
+)
+
+type message struct {
+	ja string
+	en string
+}
+
+// コードごとのメッセージ
+var messages = map[string]message{
+	CodeInvalidJSON:      {"リクエストボディのJSONが不正です", "Invalid request body"},
+	CodeUnknownField:     {"定義されていないフィールドが含まれています", "Request body has unknown fields"},
+	CodeValidationFailed: {"入力内容に誤りがあります", "Request has invalid fields"},
+	CodeInvalidParameter: {"パラメータが不正です", "Invalid parameter"},
+	CodeInvalidCursor:    {"カーソルが不正です", "Invalid cursor"},
+	CodeBodyTooLarge:     {"リクエストボディが大きすぎます", "Request body is too large"},
+
+	CodeUnauthorized:       {"ログインしてください", "Authentication required"},
+	CodeInvalidCredentials: {"ユーザー名またはパスワードが違います", "Invalid credentials"},
+	CodeInvalidAPIToken:    {"APIトークンが無効です", "Invalid API token"},
+	CodeInvalidAPIKey:      {"APIキーが無効です", "Invalid or missing API key"},
+	CodeInvalidCSRFToken:   {"CSRFトークンが無効です", "Invalid CSRF token"},
+	CodeForbidden:          {"この操作を行う権限がありません", "Insufficient role"},
+	CodeInsufficientScope:  {"APIトークンに必要なスコープがありません", "API token lacks the required scope"},
+	CodeSessionRequired:    {"この操作はAPIトークンでは行えません", "Session authentication required"},
+
+	CodeNotFound:                 {"指定されたURLは存在しません", "Not found"},
+	CodeMethodNotAllowed:         {"このメソッドは使用できません", "Method not allowed"},
+	CodeUserNotFound:             {"ユーザーが見つかりません", "User not found"},
+	CodeUserAlreadyExists:        {"ユーザーは既に存在します", "User already exists"},
+	CodeOrderNotFound:            {"注文が見つかりません", "Order not found"},
+	CodeImageNotFound:            {"画像が見つかりません", "Image not found"},
+	CodeAPITokenNotFound:         {"APIトークンが見つかりません", "API token not found"},
+	CodeWebhookNotFound:          {"Webhookが見つかりません", "Webhook not found"},
+	CodeDeliveryNotRedeliverable: {"再送できるのは送信に失敗した(dead)配信のみです", "Only dead deliveries can be retried"},
+
+	CodeTooManyExports:     {"実行中のエクスポートが多すぎます", "Too many exports in progress"},
+	CodeServiceUnavailable: {"現在サービスを利用できません", "Service unavailable"},
+	CodeTimeout:            {"処理がタイムアウトしました", "Request timed out"},
+	CodeInternal:           {"サーバー内部でエラーが発生しました", "Internal server error"},
+}
+
+// コードに対応するメッセージ
+// 未定義のコードの場合は500のメッセージを返す
+func Message(code, lang string) string {
+	m, ok := messages[code]
+	if !ok {
+		m = messages[CodeInternal]
+	}
+	if lang == LangJA {
+		return m.ja
+	}
+	return m.en
+}
+
+// エラーレスポンスをJSONで書き込む
+// detailsには違反したフィールドや、エラーの詳細(Fieldなし)を渡す
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, details ...model.FieldError) {
+	resp := model.ErrorResponse{
+		Code:      code,
+		Message:   Message(code, Language(r)),
+		Details:   details,
+		RequestID: logging.RequestIDFromContext(r.Context()),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Accept-Languageから日本語(ja)と英語(en)のうち優先される方を返す
+// どちらも含まない場合や指定がない場合はen
+func Language(r *http.Request) string {
+	lang, best := LangEN, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if primary != LangJA && primary != LangEN {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// 同じ優先度の場合は先に書かれた方を使う
+		if q > best {
+			lang, best = primary, q
+		}
+	}
+	return lang
+}
@@ -0,0 +1,585 @@
+// バックエンドの設定を一元的に読み込む
+//
+// 読み込み順 (後のものが優先):
+//  1. デフォルト値
+//  2. CONFIG_FILE で指定されたYAMLファイル (任意)
+//  3. 環境変数
+//
+// 読み込み後にValidateで検証し、不正な値があれば起動時にエラーにする。
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "[REDACTED]"
+
+// ベンチマーカー・e2eテストが使用するロボットAPIキー
+// 本番では環境変数で上書きすること
+const DefaultRobotAPIKey = "test-robot-key"
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Log       LogConfig       `yaml:"log"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Migration MigrationConfig `yaml:"migration"`
+	Export    ExportConfig    `yaml:"export"`
+	Webhook   WebhookConfig   `yaml:"webhook"`
+	Stats     StatsConfig     `yaml:"stats"`
+	// 商品画像の配置ディレクトリ
+	ImageDir string `yaml:"image_dir"`
+}
+
+type ServerConfig struct {
+	Port              string        `yaml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// ヘルスチェックを503にしてから新規接続の受付を止めるまでの待ち時間
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// 処理中のリクエストの完了を待つ最大時間
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	// user:password@tcp(host:port)/dbname 形式のDSN (パラメータは付与しない)
+	URL             string        `yaml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// 読み取り専用レプリカのDSN (URLと同じ形式)。空の場合は全てのクエリをプライマリで実行する
+	ReplicaURL string `yaml:"replica_url"`
+	// レプリカの死活を確認する間隔
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval"`
+	// 許容するレプリケーション遅延。超えた場合はプライマリから読む (0の場合は確認しない)
+	ReplicaMaxLag time.Duration `yaml:"replica_max_lag"`
+}
+
+// Redisの接続モード
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+type RedisConfig struct {
+	// standalone / sentinel / cluster
+	Mode string `yaml:"mode"`
+	// standaloneはRedis本体、sentinelはSentinel、clusterはシードノードのアドレス
+	Addrs    []string `yaml:"addrs"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	// clusterモードでは0のみ
+	DB int `yaml:"db"`
+	// sentinelモードで監視対象のマスター名
+	MasterName       string `yaml:"master_name"`
+	SentinelPassword string `yaml:"sentinel_password"`
+
+	TLS RedisTLSConfig `yaml:"tls"`
+
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	// 接続できない間、再接続を試みる間隔
+	ReconnectInterval time.Duration `yaml:"reconnect_interval"`
+}
+
+type RedisTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type AuthConfig struct {
+	RobotAPIKey    string `yaml:"robot_api_key"`
+	CookieSecure   bool   `yaml:"cookie_secure"`
+	CookieSameSite string `yaml:"cookie_same_site"`
+	// CSRFトークンの検証を省略するOrigin (e2eテスト用)
+	CSRFTrustedOrigins []string `yaml:"csrf_trusted_origins"`
+}
+
+type LogConfig struct {
+	// debug / info / warn / error
+	Level string `yaml:"level"`
+}
+
+type MetricsConfig struct {
+	// /metricsエンドポイントを公開するか
+	Enabled bool `yaml:"enabled"`
+	// ステータス別注文数の集計クエリを再実行する間隔
+	OrderCountsInterval time.Duration `yaml:"order_counts_interval"`
+}
+
+type MigrationConfig struct {
+	// マイグレーションSQLの配置ディレクトリ (webapp/mysql/migrationをマウントする)
+	Dir string `yaml:"dir"`
+	// 起動時に未適用のマイグレーションを適用するか
+	AutoApply bool `yaml:"auto_apply"`
+	// 起動時にスキーマがファイルと一致しているかを確認し、不一致なら起動しないか
+	Check bool `yaml:"check"`
+	// 他のバックエンドがマイグレーション中の場合にロックを待つ最大時間
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+}
+
+type ExportConfig struct {
+	// ユーザーごとに同時に実行できる注文履歴エクスポートの数 (バックエンドのプロセスごと)
+	MaxConcurrentPerUser int `yaml:"max_concurrent_per_user"`
+	// 1回のクエリで取得する行数
+	BatchSize int `yaml:"batch_size"`
+}
+
+type WebhookConfig struct {
+	// このプロセスで送信ワーカーを動かすか (複数台構成では一部のみで動かしてもよい)
+	DispatcherEnabled bool `yaml:"dispatcher_enabled"`
+	// 送信待ちのイベントを確認する間隔
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// 1回に取得して並行に送信する件数
+	BatchSize int `yaml:"batch_size"`
+	// 1回の送信のタイムアウト
+	Timeout time.Duration `yaml:"timeout"`
+	// 送信を試みる最大回数。超えた場合はdeadにして再試行しない
+	MaxAttempts int `yaml:"max_attempts"`
+	// ループバック・プライベートアドレスへの送信を許可するか (ローカルでの動作確認用)
+	AllowPrivateTargets bool `yaml:"allow_private_targets"`
+}
+
+type StatsConfig struct {
+	// 配送統計をRedisにキャッシュする時間
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// 一度に集計できる最大の期間
+	MaxWindow time.Duration `yaml:"max_window"`
+}
+
+// slogのログレベル
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return 0, fmt.Errorf("%q must be one of debug, info, warn, error", l.Level)
+	}
+	return level, nil
+}
+
+// デフォルト値
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:              "8080",
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			// サービス層のタイムアウト(120秒)より長くしておく
+			WriteTimeout:    130 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			URL: "user:password@tcp(db:4306)/42Tokyo2508-db",
+			// VM環境に合わせて接続数を抑えている
+			MaxOpenConns:    15,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 30 * time.Second,
+
+			ReplicaCheckInterval: 5 * time.Second,
+		},
+		Redis: RedisConfig{
+			Mode:              RedisModeStandalone,
+			Addrs:             []string{"redis:6379"}, // Dockerネットワーク内のアドレス
+			DialTimeout:       2 * time.Second,
+			ReconnectInterval: 5 * time.Second,
+		},
+		Auth: AuthConfig{
+			RobotAPIKey:    DefaultRobotAPIKey,
+			CookieSameSite: "lax",
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Metrics: MetricsConfig{
+			Enabled:             true,
+			OrderCountsInterval: 15 * time.Second,
+		},
+		Migration: MigrationConfig{
+			Dir:         "/app/migration",
+			Check:       true,
+			LockTimeout: 60 * time.Second,
+		},
+		Export: ExportConfig{
+			MaxConcurrentPerUser: 2,
+			BatchSize:            500,
+		},
+		Webhook: WebhookConfig{
+			DispatcherEnabled: true,
+			PollInterval:      time.Second,
+			BatchSize:         20,
+			Timeout:           10 * time.Second,
+			MaxAttempts:       8,
+		},
+		Stats: StatsConfig{
+			CacheTTL:  time.Minute,
+			MaxWindow: 92 * 24 * time.Hour,
+		},
+		ImageDir: "/app/images",
+	}
+}
+
+// 設定を読み込んで検証する
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	integer := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration like \"10s\"", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+	list := func(key string, dst *[]string) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			var items []string
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*dst = items
+		}
+	}
+
+	str("PORT", &c.Server.Port)
+	duration("HTTP_READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("HTTP_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	duration("HTTP_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("HTTP_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	duration("SHUTDOWN_DRAIN_DELAY", &c.Server.DrainDelay)
+	duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	str("DATABASE_URL", &c.Database.URL)
+	integer("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	integer("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	duration("DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	str("DATABASE_REPLICA_URL", &c.Database.ReplicaURL)
+	duration("DB_REPLICA_CHECK_INTERVAL", &c.Database.ReplicaCheckInterval)
+	duration("DB_REPLICA_MAX_LAG", &c.Database.ReplicaMaxLag)
+
+	str("REDIS_MODE", &c.Redis.Mode)
+	list("REDIS_ADDR", &c.Redis.Addrs)
+	str("REDIS_USERNAME", &c.Redis.Username)
+	str("REDIS_PASSWORD", &c.Redis.Password)
+	integer("REDIS_DB", &c.Redis.DB)
+	str("REDIS_MASTER_NAME", &c.Redis.MasterName)
+	str("REDIS_SENTINEL_PASSWORD", &c.Redis.SentinelPassword)
+	boolean("REDIS_TLS", &c.Redis.TLS.Enabled)
+	str("REDIS_TLS_CA_FILE", &c.Redis.TLS.CAFile)
+	str("REDIS_TLS_SERVER_NAME", &c.Redis.TLS.ServerName)
+	boolean("REDIS_TLS_INSECURE_SKIP_VERIFY", &c.Redis.TLS.InsecureSkipVerify)
+	duration("REDIS_DIAL_TIMEOUT", &c.Redis.DialTimeout)
+	duration("REDIS_RECONNECT_INTERVAL", &c.Redis.ReconnectInterval)
+
+	str("ROBOT_API_KEY", &c.Auth.RobotAPIKey)
+	boolean("SESSION_COOKIE_SECURE", &c.Auth.CookieSecure)
+	str("SESSION_COOKIE_SAMESITE", &c.Auth.CookieSameSite)
+	list("CSRF_TRUSTED_ORIGINS", &c.Auth.CSRFTrustedOrigins)
+
+	str("LOG_LEVEL", &c.Log.Level)
+
+	boolean("METRICS_ENABLED", &c.Metrics.Enabled)
+	duration("METRICS_ORDER_COUNTS_INTERVAL", &c.Metrics.OrderCountsInterval)
+
+	str("MIGRATION_DIR", &c.Migration.Dir)
+	boolean("MIGRATION_AUTO_APPLY", &c.Migration.AutoApply)
+	boolean("MIGRATION_CHECK", &c.Migration.Check)
+	duration("MIGRATION_LOCK_TIMEOUT", &c.Migration.LockTimeout)
+
+	integer("EXPORT_MAX_CONCURRENT_PER_USER", &c.Export.MaxConcurrentPerUser)
+	integer("EXPORT_BATCH_SIZE", &c.Export.BatchSize)
+
+	boolean("WEBHOOK_DISPATCHER_ENABLED", &c.Webhook.DispatcherEnabled)
+	duration("WEBHOOK_POLL_INTERVAL", &c.Webhook.PollInterval)
+	integer("WEBHOOK_BATCH_SIZE", &c.Webhook.BatchSize)
+	duration("WEBHOOK_TIMEOUT", &c.Webhook.Timeout)
+	integer("WEBHOOK_MAX_ATTEMPTS", &c.Webhook.MaxAttempts)
+	boolean("WEBHOOK_ALLOW_PRIVATE_TARGETS", &c.Webhook.AllowPrivateTargets)
+
+	duration("STATS_CACHE_TTL", &c.Stats.CacheTTL)
+	duration("STATS_MAX_WINDOW", &c.Stats.MaxWindow)
+
+	str("IMAGE_DIR", &c.ImageDir)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid environment variables: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// 設定値を検証し、問題を全てまとめて返す
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		add("server.port: %q is not a valid port", c.Server.Port)
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.drain_delay", c.Server.DrainDelay},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"database.conn_max_lifetime", c.Database.ConnMaxLifetime},
+		{"database.conn_max_idle_time", c.Database.ConnMaxIdleTime},
+		{"database.replica_max_lag", c.Database.ReplicaMaxLag},
+	} {
+		if d.value < 0 {
+			add("%s: must not be negative", d.name)
+		}
+	}
+
+	if c.Database.URL == "" {
+		add("database.url: required")
+	} else if _, err := mysql.ParseDSN(c.Database.URL); err != nil {
+		// エラーメッセージにDSNが含まれる場合があるため詳細は出さない
+		add("database.url: not a valid MySQL DSN")
+	}
+	if c.Database.ReplicaURL != "" {
+		if _, err := mysql.ParseDSN(c.Database.ReplicaURL); err != nil {
+			add("database.replica_url: not a valid MySQL DSN")
+		}
+		if c.Database.ReplicaCheckInterval <= 0 {
+			add("database.replica_check_interval: must be positive")
+		}
+	}
+	if c.Database.MaxOpenConns < 1 {
+		add("database.max_open_conns: must be at least 1")
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		add("database.max_idle_conns: must be between 0 and max_open_conns")
+	}
+
+	if len(c.Redis.Addrs) == 0 {
+		add("redis.addrs: at least one address is required")
+	}
+	if c.Redis.DB < 0 {
+		add("redis.db: must not be negative")
+	}
+	switch c.Redis.Mode {
+	case RedisModeStandalone:
+		if len(c.Redis.Addrs) > 1 {
+			add("redis.addrs: standalone mode accepts a single address (use mode=cluster for multiple nodes)")
+		}
+	case RedisModeSentinel:
+		if c.Redis.MasterName == "" {
+			add("redis.master_name: required in sentinel mode")
+		}
+	case RedisModeCluster:
+		if c.Redis.DB != 0 {
+			add("redis.db: cluster mode supports only db 0")
+		}
+	default:
+		add("redis.mode: %q must be one of standalone, sentinel, cluster", c.Redis.Mode)
+	}
+	if c.Redis.ReconnectInterval <= 0 {
+		add("redis.reconnect_interval: must be positive")
+	}
+	if c.Redis.DialTimeout < 0 {
+		add("redis.dial_timeout: must not be negative")
+	}
+	if c.Redis.TLS.CAFile != "" && !c.Redis.TLS.Enabled {
+		add("redis.tls.ca_file: requires tls.enabled=true")
+	}
+
+	if c.Auth.RobotAPIKey == "" {
+		add("auth.robot_api_key: required")
+	}
+	if _, err := c.Auth.SameSite(); err != nil {
+		add("auth.cookie_same_site: %v", err)
+	} else if strings.EqualFold(c.Auth.CookieSameSite, "none") && !c.Auth.CookieSecure {
+		// SameSite=NoneはSecure属性なしだとブラウザに拒否される
+		add("auth.cookie_same_site: none requires cookie_secure=true")
+	}
+
+	if _, err := c.Log.SlogLevel(); err != nil {
+		add("log.level: %v", err)
+	}
+
+	if c.Metrics.OrderCountsInterval <= 0 {
+		add("metrics.order_counts_interval: must be positive")
+	}
+
+	if c.Migration.Dir == "" {
+		add("migration.dir: required")
+	}
+	// GET_LOCKのタイムアウトは秒単位
+	if c.Migration.LockTimeout < time.Second {
+		add("migration.lock_timeout: must be at least 1s")
+	}
+
+	if c.Export.MaxConcurrentPerUser < 1 {
+		add("export.max_concurrent_per_user: must be at least 1")
+	}
+	if c.Export.BatchSize < 1 || c.Export.BatchSize > 10000 {
+		add("export.batch_size: must be between 1 and 10000")
+	}
+
+	if c.Webhook.PollInterval <= 0 {
+		add("webhook.poll_interval: must be positive")
+	}
+	if c.Webhook.BatchSize < 1 || c.Webhook.BatchSize > 100 {
+		add("webhook.batch_size: must be between 1 and 100")
+	}
+	if c.Webhook.Timeout <= 0 {
+		add("webhook.timeout: must be positive")
+	}
+	if c.Webhook.MaxAttempts < 1 {
+		add("webhook.max_attempts: must be at least 1")
+	}
+
+	// 0の場合はキャッシュしない
+	if c.Stats.CacheTTL < 0 {
+		add("stats.cache_ttl: must not be negative")
+	}
+	if c.Stats.MaxWindow < time.Hour {
+		add("stats.max_window: must be at least 1h")
+	}
+
+	if c.ImageDir == "" {
+		add("image_dir: required")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Cookieに付与するSameSite属性
+func (a AuthConfig) SameSite() (http.SameSite, error) {
+	switch strings.ToLower(a.CookieSameSite) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("%q must be one of lax, strict, none", a.CookieSameSite)
+}
+
+// ログ出力用に秘密情報をマスクしたコピーを返す
+func (c Config) Redacted() Config {
+	c.Database.URL = redactDSN(c.Database.URL)
+	if c.Database.ReplicaURL != "" {
+		c.Database.ReplicaURL = redactDSN(c.Database.ReplicaURL)
+	}
+	if c.Redis.Password != "" {
+		c.Redis.Password = redactedValue
+	}
+	if c.Redis.SentinelPassword != "" {
+		c.Redis.SentinelPassword = redactedValue
+	}
+	c.Redis.Addrs = append([]string(nil), c.Redis.Addrs...)
+	if c.Auth.RobotAPIKey != "" {
+		c.Auth.RobotAPIKey = redactedValue
+	}
+	c.Auth.CSRFTrustedOrigins = append([]string(nil), c.Auth.CSRFTrustedOrigins...)
+	return c
+}
+
+// 秘密情報をマスクした設定を文字列で返す
+func (c Config) String() string {
+	// Stringを持たない型に変換して再帰呼び出しを避ける
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+// DSNのパスワード部分をマスクする
+func redactDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redactedValue
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redactedValue
+	}
+	return cfg.FormatDSN()
+}
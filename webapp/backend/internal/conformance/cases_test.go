@@ -0,0 +1,201 @@
+package conformance
+
+import (
+	"net/http"
+	"strings"
+)
+
+// リクエストの認証方法
+type authKind string
+
+const (
+	authNone     authKind = ""
+	authAdmin    authKind = "admin"
+	authManager  authKind = "manager"
+	authOperator authKind = "operator"
+	// allScopesTokenのAPIトークン
+	authToken authKind = "token"
+	// ordersReadTokenのAPIトークン
+	authReadToken authKind = "read-token"
+	authRobot     authKind = "robot"
+)
+
+// 1つのリクエストと期待するステータスコード
+//
+// レスポンスのステータスコード・Content-Type・ボディが定義と一致するかはRunが共通に確認するため、
+// ケースには定義との比較では分からない期待値 (どのステータスになるべきか) のみを書く
+type Case struct {
+	Name   string
+	Method string
+	// クエリを含む実際のパス
+	Path string
+	Auth authKind
+	// リクエストボディ
+	// stringはそのまま送り、それ以外はJSONにする。nilの場合は定義の必須のボディから生成する
+	Body   any
+	Header map[string]string
+	Status int
+	// ボディが定義に違反していることを期待する
+	// サーバーが拒否する入力を定義も拒否するか (制約が定義に書かれているか) を確認する
+	Invalid bool
+	// このSQLに一致するクエリを失敗させる (500の確認用)
+	// 接続の確認は "PING" として照合する
+	FailQuery string
+	// SSEの接続後に送るリクエスト
+	// 設定した場合は、このリクエストで発生したイベントを受信できることを確認する
+	Trigger *Case
+}
+
+// 商品一覧のボディ (次のページがあるようにpage_sizeを1にする)
+const firstProductPage = `{"page_size":1,"include_total":true}`
+
+// 検証するリクエストの一覧
+// 定義された全てのオペレーションについて、少なくとも1つの2xxのケースを含めること
+func Cases() []Case {
+	return []Case{
+		// ログイン
+		{Name: "login", Method: http.MethodPost, Path: "/api/login",
+			Body: map[string]any{"user_name": adminUser.name, "password": fixturePassword}, Status: http.StatusOK},
+		{Name: "login with wrong password", Method: http.MethodPost, Path: "/api/login",
+			Body: map[string]any{"user_name": adminUser.name, "password": "wrong-password"}, Status: http.StatusUnauthorized},
+		{Name: "login with unknown user", Method: http.MethodPost, Path: "/api/login",
+			Body: map[string]any{"user_name": "nobody", "password": fixturePassword}, Status: http.StatusUnauthorized},
+		{Name: "login with unknown field", Method: http.MethodPost, Path: "/api/login",
+			Body: map[string]any{"username": adminUser.name, "password": fixturePassword}, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "login with malformed JSON", Method: http.MethodPost, Path: "/api/login",
+			Body: `{"user_name":`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "login with too large body", Method: http.MethodPost, Path: "/api/login",
+			Body: `{"user_name":"` + strings.Repeat("a", 1<<20) + `","password":"x"}`, Status: http.StatusRequestEntityTooLarge},
+
+		// ヘルスチェック
+		{Name: "health", Method: http.MethodGet, Path: "/api/health", Status: http.StatusOK},
+		{Name: "liveness", Method: http.MethodGet, Path: "/api/health/live", Status: http.StatusOK},
+		{Name: "readiness", Method: http.MethodGet, Path: "/api/health/ready", Status: http.StatusOK},
+		{Name: "readiness with database down", Method: http.MethodGet, Path: "/api/health/ready",
+			FailQuery: `.`, Status: http.StatusServiceUnavailable},
+
+		// 商品
+		{Name: "list products", Method: http.MethodPost, Path: "/api/v1/product", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "list products with token and cursor", Method: http.MethodPost, Path: "/api/v1/product", Auth: authToken,
+			Body: firstProductPage, Status: http.StatusOK},
+		{Name: "list products without authentication", Method: http.MethodPost, Path: "/api/v1/product",
+			Body: `{}`, Status: http.StatusUnauthorized},
+		{Name: "list products with invalid token", Method: http.MethodPost, Path: "/api/v1/product",
+			Header: map[string]string{"Authorization": "Bearer wht_unknown"}, Body: `{}`, Status: http.StatusUnauthorized},
+		{Name: "list products without scope", Method: http.MethodPost, Path: "/api/v1/product", Auth: authReadToken,
+			Body: `{}`, Status: http.StatusForbidden},
+		{Name: "list products with too large page", Method: http.MethodPost, Path: "/api/v1/product", Auth: authAdmin,
+			Body: `{"page_size":1000}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "list products with invalid cursor", Method: http.MethodPost, Path: "/api/v1/product", Auth: authAdmin,
+			Body: `{"cursor":"not-a-cursor"}`, Status: http.StatusBadRequest},
+		{Name: "list products with database error", Method: http.MethodPost, Path: "/api/v1/product", Auth: authAdmin,
+			Body: `{"search":"mug"}`, FailQuery: `FROM products`, Status: http.StatusInternalServerError},
+		{Name: "product image", Method: http.MethodGet, Path: "/api/v1/image?path=" + sampleImage, Auth: authAdmin, Status: http.StatusOK},
+		{Name: "product image without path", Method: http.MethodGet, Path: "/api/v1/image", Auth: authAdmin, Status: http.StatusBadRequest},
+		{Name: "product image outside the image directory", Method: http.MethodGet, Path: "/api/v1/image?path=../secret.png", Auth: authAdmin, Status: http.StatusBadRequest},
+		{Name: "missing product image", Method: http.MethodGet, Path: "/api/v1/image?path=missing.png", Auth: authAdmin, Status: http.StatusNotFound},
+
+		// 注文
+		{Name: "create orders", Method: http.MethodPost, Path: "/api/v1/product/post", Auth: authManager,
+			Body: `{"items":[{"product_id":1,"quantity":2}]}`, Status: http.StatusCreated},
+		{Name: "create orders with token", Method: http.MethodPost, Path: "/api/v1/product/post", Auth: authToken,
+			Body: `{"items":[{"product_id":2,"quantity":1}]}`, Status: http.StatusCreated},
+		{Name: "create orders as operator", Method: http.MethodPost, Path: "/api/v1/product/post", Auth: authOperator,
+			Body: `{"items":[{"product_id":1,"quantity":1}]}`, Status: http.StatusForbidden},
+		{Name: "create orders with zero quantity", Method: http.MethodPost, Path: "/api/v1/product/post", Auth: authManager,
+			Body: `{"items":[{"product_id":1,"quantity":0}]}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create orders without items", Method: http.MethodPost, Path: "/api/v1/product/post", Auth: authManager,
+			Body: `{"items":[]}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create orders with forged CSRF token", Method: http.MethodPost, Path: "/api/v1/product/post", Auth: authManager,
+			Header: map[string]string{"X-XSRF-TOKEN": "forged"}, Body: `{"items":[{"product_id":1,"quantity":1}]}`, Status: http.StatusForbidden},
+		{Name: "list orders", Method: http.MethodPost, Path: "/api/v1/orders", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "list orders with filters", Method: http.MethodPost, Path: "/api/v1/orders", Auth: authReadToken,
+			Body:   `{"statuses":["shipping","completed"],"created_from":"2025-01-01T00:00:00Z","sort_field":"created_at","sort_order":"desc","include_total":false}`,
+			Status: http.StatusOK},
+		{Name: "list orders with unknown status", Method: http.MethodPost, Path: "/api/v1/orders", Auth: authAdmin,
+			Body: `{"statuses":["lost"]}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "export orders as CSV", Method: http.MethodPost, Path: "/api/v1/orders/export", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "export orders as JSON Lines", Method: http.MethodPost, Path: "/api/v1/orders/export?format=ndjson", Auth: authReadToken,
+			Body: `{"statuses":["completed"]}`, Status: http.StatusOK},
+		{Name: "export orders in unknown format", Method: http.MethodPost, Path: "/api/v1/orders/export?format=xml", Auth: authAdmin,
+			Status: http.StatusBadRequest},
+		{Name: "order events", Method: http.MethodGet, Path: "/api/v1/orders/events", Auth: authAdmin, Status: http.StatusOK,
+			Trigger: &Case{Name: "order status update", Method: http.MethodPatch, Path: "/api/robot/orders/status", Auth: authRobot,
+				Body: `{"order_id":1,"new_status":"delivering"}`, Status: http.StatusOK}},
+		{Name: "order events with invalid Last-Event-ID", Method: http.MethodGet, Path: "/api/v1/orders/events", Auth: authAdmin,
+			Header: map[string]string{"Last-Event-ID": "abc"}, Status: http.StatusBadRequest},
+		{Name: "order timeline", Method: http.MethodGet, Path: "/api/v1/orders/1/timeline", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "timeline of another user's order", Method: http.MethodGet, Path: "/api/v1/orders/999/timeline", Auth: authAdmin, Status: http.StatusNotFound},
+		{Name: "timeline with invalid order ID", Method: http.MethodGet, Path: "/api/v1/orders/abc/timeline", Auth: authAdmin, Status: http.StatusBadRequest},
+
+		// 配送統計
+		{Name: "delivery stats", Method: http.MethodGet, Path: "/api/v1/stats/delivery", Auth: authOperator, Status: http.StatusOK},
+		{Name: "delivery stats for a period", Method: http.MethodGet,
+			Path: "/api/v1/stats/delivery?from=2025-05-01T00:00:00Z&to=2025-06-01T00:00:00Z", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "delivery stats as store manager", Method: http.MethodGet, Path: "/api/v1/stats/delivery", Auth: authManager, Status: http.StatusForbidden},
+		{Name: "delivery stats with invalid date", Method: http.MethodGet, Path: "/api/v1/stats/delivery?from=yesterday", Auth: authAdmin, Status: http.StatusBadRequest},
+
+		// ユーザー
+		{Name: "create user", Method: http.MethodPost, Path: "/api/v1/users", Auth: authAdmin, Status: http.StatusCreated},
+		{Name: "create existing user", Method: http.MethodPost, Path: "/api/v1/users", Auth: authAdmin,
+			Body: map[string]any{"user_name": managerUser.name, "password": fixturePassword}, Status: http.StatusConflict},
+		{Name: "create user with short password", Method: http.MethodPost, Path: "/api/v1/users", Auth: authAdmin,
+			Body: `{"user_name":"staff02","password":"short"}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create user with unknown role", Method: http.MethodPost, Path: "/api/v1/users", Auth: authAdmin,
+			Body: `{"user_name":"staff02","password":"long-enough","role":"owner"}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create user as store manager", Method: http.MethodPost, Path: "/api/v1/users", Auth: authManager, Status: http.StatusForbidden},
+		{Name: "change password", Method: http.MethodPost, Path: "/api/v1/users/me/password", Auth: authManager,
+			Body: map[string]any{"current_password": fixturePassword, "new_password": "new-conformance-password"}, Status: http.StatusOK},
+		{Name: "change password with wrong current password", Method: http.MethodPost, Path: "/api/v1/users/me/password", Auth: authManager,
+			Body: map[string]any{"current_password": "wrong-password", "new_password": "new-conformance-password"}, Status: http.StatusUnauthorized},
+		{Name: "change password with token", Method: http.MethodPost, Path: "/api/v1/users/me/password", Auth: authToken,
+			Body: map[string]any{"current_password": fixturePassword, "new_password": "new-conformance-password"}, Status: http.StatusForbidden},
+
+		// APIトークン
+		{Name: "list API tokens", Method: http.MethodGet, Path: "/api/v1/tokens", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "list API tokens with database error", Method: http.MethodGet, Path: "/api/v1/tokens", Auth: authAdmin,
+			FailQuery: `FROM api_tokens WHERE user_id`, Status: http.StatusInternalServerError},
+		{Name: "create API token", Method: http.MethodPost, Path: "/api/v1/tokens", Auth: authAdmin, Status: http.StatusCreated},
+		{Name: "create API token with expiry", Method: http.MethodPost, Path: "/api/v1/tokens", Auth: authOperator,
+			Body: `{"name":"nightly export","scopes":["orders:read"],"expires_in_days":30}`, Status: http.StatusCreated},
+		{Name: "create API token with unknown scope", Method: http.MethodPost, Path: "/api/v1/tokens", Auth: authAdmin,
+			Body: `{"name":"ci","scopes":["users:write"]}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create API token without scopes", Method: http.MethodPost, Path: "/api/v1/tokens", Auth: authAdmin,
+			Body: `{"name":"ci","scopes":[]}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create API token with token", Method: http.MethodPost, Path: "/api/v1/tokens", Auth: authToken,
+			Body: `{"name":"ci","scopes":["orders:read"]}`, Status: http.StatusForbidden},
+		{Name: "revoke API token", Method: http.MethodDelete, Path: "/api/v1/tokens/2", Auth: authAdmin, Status: http.StatusNoContent},
+		{Name: "revoke unknown API token", Method: http.MethodDelete, Path: "/api/v1/tokens/999", Auth: authAdmin, Status: http.StatusNotFound},
+		{Name: "revoke API token with invalid ID", Method: http.MethodDelete, Path: "/api/v1/tokens/abc", Auth: authAdmin, Status: http.StatusBadRequest},
+
+		// Webhook
+		{Name: "list webhooks", Method: http.MethodGet, Path: "/api/v1/webhooks", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "create webhook", Method: http.MethodPost, Path: "/api/v1/webhooks", Auth: authAdmin, Status: http.StatusCreated},
+		{Name: "create webhook with unsupported scheme", Method: http.MethodPost, Path: "/api/v1/webhooks", Auth: authAdmin,
+			Body: `{"url":"ftp://hooks.example.com/orders","event_types":["order.created"]}`, Status: http.StatusBadRequest},
+		{Name: "create webhook with unknown event", Method: http.MethodPost, Path: "/api/v1/webhooks", Auth: authAdmin,
+			Body: `{"url":"https://hooks.example.com/orders","event_types":["order.lost"]}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "create webhook with token", Method: http.MethodPost, Path: "/api/v1/webhooks", Auth: authToken,
+			Body: `{"url":"https://hooks.example.com/orders","event_types":["order.created"]}`, Status: http.StatusForbidden},
+		{Name: "delete webhook", Method: http.MethodDelete, Path: "/api/v1/webhooks/1", Auth: authAdmin, Status: http.StatusNoContent},
+		{Name: "delete unknown webhook", Method: http.MethodDelete, Path: "/api/v1/webhooks/999", Auth: authAdmin, Status: http.StatusNotFound},
+		{Name: "list webhook deliveries", Method: http.MethodGet, Path: "/api/v1/webhooks/1/deliveries", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "list webhook deliveries with limit", Method: http.MethodGet, Path: "/api/v1/webhooks/1/deliveries?limit=1", Auth: authAdmin, Status: http.StatusOK},
+		{Name: "list webhook deliveries with invalid limit", Method: http.MethodGet, Path: "/api/v1/webhooks/1/deliveries?limit=0", Auth: authAdmin, Status: http.StatusBadRequest},
+		{Name: "list deliveries of unknown webhook", Method: http.MethodGet, Path: "/api/v1/webhooks/999/deliveries", Auth: authAdmin, Status: http.StatusNotFound},
+		{Name: "redeliver webhook", Method: http.MethodPost, Path: "/api/v1/webhooks/1/deliveries/1/retry", Auth: authAdmin, Status: http.StatusAccepted},
+		{Name: "redeliver succeeded webhook", Method: http.MethodPost, Path: "/api/v1/webhooks/1/deliveries/2/retry", Auth: authAdmin, Status: http.StatusConflict},
+		{Name: "redeliver to unknown webhook", Method: http.MethodPost, Path: "/api/v1/webhooks/999/deliveries/1/retry", Auth: authAdmin, Status: http.StatusNotFound},
+
+		// ロボット
+		{Name: "delivery plan", Method: http.MethodGet, Path: "/api/robot/delivery-plan?capacity=10", Auth: authRobot, Status: http.StatusOK},
+		{Name: "delivery plan without capacity", Method: http.MethodGet, Path: "/api/robot/delivery-plan", Auth: authRobot, Status: http.StatusBadRequest},
+		{Name: "delivery plan without API key", Method: http.MethodGet, Path: "/api/robot/delivery-plan?capacity=10", Status: http.StatusForbidden},
+		{Name: "update order status", Method: http.MethodPatch, Path: "/api/robot/orders/status", Auth: authRobot,
+			Body: `{"order_id":1,"new_status":"completed"}`, Status: http.StatusOK},
+		{Name: "update order status to unknown status", Method: http.MethodPatch, Path: "/api/robot/orders/status", Auth: authRobot,
+			Body: `{"order_id":1,"new_status":"complete"}`, Status: http.StatusBadRequest, Invalid: true},
+		{Name: "update order status with invalid order ID", Method: http.MethodPatch, Path: "/api/robot/orders/status", Auth: authRobot,
+			Body: `{"order_id":0,"new_status":"completed"}`, Status: http.StatusBadRequest, Invalid: true},
+	}
+}
@@ -0,0 +1,54 @@
+package conformance
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"backend/internal/config"
+	"backend/internal/logging"
+)
+
+const specFile = "../../../../documents/api-specs/openapi_defn.yaml"
+
+func TestConformance(t *testing.T) {
+	spec, err := LoadSpec(specFile)
+	if err != nil {
+		t.Fatalf("LoadSpec: %v", err)
+	}
+	// エラーのレスポンスを確認するケースが多いため、サーバーのログは出さない
+	r, stop, err := start(config.Default(), spec, logging.New(io.Discard, slog.LevelError))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(stop)
+
+	t.Run("routes", func(t *testing.T) {
+		report(t, r.checkRoutes())
+	})
+
+	// ケースは同じfakeDBを使うため、並列にしない
+	ran := 0
+	t.Run("cases", func(t *testing.T) {
+		for _, tc := range Cases() {
+			t.Run(tc.Method+" "+tc.Path+" "+tc.Name, func(t *testing.T) {
+				ran++
+				report(t, r.check(tc))
+			})
+		}
+	})
+
+	t.Run("coverage", func(t *testing.T) {
+		if ran != len(Cases()) {
+			t.Skip("-run selected only some of the cases")
+		}
+		report(t, r.checkCoverage())
+	})
+}
+
+func report(t *testing.T, res Result) {
+	t.Helper()
+	for _, e := range res.Errors {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,264 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MySQLの代わりに固定のデータを返すdatabase/sqlのドライバー
+//
+// クエリは空白を詰めたSQLを規則の正規表現と順に照合し、最初に一致した規則で応答する。
+// SELECTに一致する規則がない場合はエラーを返し、どのクエリが未対応かを記録する。
+// INSERT・UPDATE・DELETEは規則がなければ1行を変更したものとして成功させる。
+// トランザクションは受け付けるだけで、ロールバックしても変更は元に戻らない (そもそも保存しない)
+type fakeDB struct {
+	mu     sync.Mutex
+	rules  []queryRule
+	lastID int64
+	// 一致したクエリを失敗させる (500の確認用)
+	fail *regexp.Regexp
+	// 規則のなかったクエリ
+	unmatched []string
+}
+
+// クエリに対する応答の規則
+// rowsとexecのどちらか一方を設定する
+type queryRule struct {
+	pattern *regexp.Regexp
+	columns []string
+	rows    func(args []driver.Value) [][]driver.Value
+	exec    func(db *fakeDB, args []driver.Value) (driver.Result, error)
+}
+
+var spacePattern = regexp.MustCompile(`\s+`)
+
+// 改行やインデントの違いを無視して照合するため、空白を1つのスペースに詰める
+func normalizeQuery(query string) string {
+	return strings.TrimSpace(spacePattern.ReplaceAllString(query, " "))
+}
+
+func newFakeDB(rules []queryRule) *fakeDB {
+	return &fakeDB{rules: rules, lastID: 1000}
+}
+
+// fakeDBに接続するsqlx.DB
+// リポジトリのクエリはMySQLのプレースホルダ(?)で書かれているため、ドライバー名はmysqlとして扱う
+func (f *fakeDB) open() *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(fakeConnector{db: f}), "mysql")
+}
+
+// ケースごとに失敗させるクエリを切り替え、未対応のクエリの記録を消す
+func (f *fakeDB) reset(fail *regexp.Regexp) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+	f.unmatched = nil
+}
+
+func (f *fakeDB) takeUnmatched() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.unmatched
+	f.unmatched = nil
+	return u
+}
+
+func (f *fakeDB) nextID() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastID++
+	return f.lastID
+}
+
+// クエリに一致する規則 (なければnil)
+func (f *fakeDB) match(q string, exec bool) (*queryRule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil && f.fail.MatchString(q) {
+		return nil, fmt.Errorf("conformance: injected failure for query: %s", q)
+	}
+	for i := range f.rules {
+		r := &f.rules[i]
+		if (r.exec != nil) == exec && r.pattern.MatchString(q) {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// 接続の確認は "PING" というクエリとして失敗させるかを照合する
+func (f *fakeDB) ping() error {
+	_, err := f.match("PING", false)
+	return err
+}
+
+func (f *fakeDB) recordUnmatched(q string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unmatched = append(f.unmatched, q)
+	return fmt.Errorf("conformance: no fixture for query: %s", q)
+}
+
+func (f *fakeDB) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	q := normalizeQuery(query)
+	rule, err := f.match(q, false)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return nil, f.recordUnmatched(q)
+	}
+	return &fakeRows{columns: rule.columns, rows: rule.rows(values(args))}, nil
+}
+
+func (f *fakeDB) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	q := normalizeQuery(query)
+	if !isWrite(q) {
+		return nil, f.recordUnmatched(q)
+	}
+	rule, err := f.match(q, true)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		// 書き込みの規則がなければ1行を変更したものとして扱う
+		return fakeResult{lastInsertID: f.nextID(), rowsAffected: 1}, nil
+	}
+	return rule.exec(f, values(args))
+}
+
+func isWrite(q string) bool {
+	for _, prefix := range []string{"INSERT ", "UPDATE ", "DELETE "} {
+		if strings.HasPrefix(strings.ToUpper(q), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vs := make([]driver.Value, len(args))
+	for i, a := range args {
+		vs[i] = a.Value
+	}
+	return vs
+}
+
+type fakeConnector struct {
+	db *fakeDB
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{db: c.db} }
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{db: d.db}, nil }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+var (
+	_ driver.QueryerContext     = (*fakeConn)(nil)
+	_ driver.ExecerContext      = (*fakeConn)(nil)
+	_ driver.ConnBeginTx        = (*fakeConn)(nil)
+	_ driver.Pinger             = (*fakeConn)(nil)
+	_ driver.ConnPrepareContext = (*fakeConn)(nil)
+)
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	return c.Prepare(query)
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) Ping(context.Context) error { return c.db.ping() }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query, args)
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.db.exec(query, args)
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.db.exec(s.query, named(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.db.query(s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nvs
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	row := r.rows[r.pos]
+	r.pos++
+	if len(row) != len(dest) {
+		return errors.New("conformance: fixture row does not match its columns")
+	}
+	copy(dest, row)
+	return nil
+}
@@ -0,0 +1,339 @@
+package conformance
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"backend/internal/model"
+	"backend/internal/service/utils"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 検証用のデータ
+//
+// 管理者(admin)の注文・APIトークン・Webhookを用意し、他のユーザーはロールの確認にのみ使う。
+// 書き込みは保存しないため、どのケースから実行しても同じ結果になる
+const fixturePassword = "conformance-password"
+
+var fixtureTime = time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+type fixtureUser struct {
+	id      int
+	name    string
+	role    string
+	session string
+}
+
+var (
+	adminUser    = fixtureUser{1, "admin", model.RoleAdmin, "00000000-0000-4000-8000-000000000001"}
+	managerUser  = fixtureUser{2, "manager", model.RoleStoreManager, "00000000-0000-4000-8000-000000000002"}
+	operatorUser = fixtureUser{3, "operator", model.RoleOperator, "00000000-0000-4000-8000-000000000003"}
+
+	fixtureUsers = []fixtureUser{adminUser, managerUser, operatorUser}
+)
+
+// 管理者のAPIトークン
+type fixtureToken struct {
+	id     int64
+	plain  string
+	scopes string
+}
+
+var (
+	// 全てのスコープを持つ
+	allScopesToken = fixtureToken{1, "wht_conformanceAllScopes", "products:read orders:read orders:write"}
+	// orders:readのみ
+	ordersReadToken = fixtureToken{2, "wht_conformanceOrdersRead", "orders:read"}
+	// 失効済み
+	revokedTokenID int64 = 3
+
+	fixtureTokens = []fixtureToken{allScopesToken, ordersReadToken}
+)
+
+const (
+	// 管理者のWebhook
+	fixtureWebhookID = 1
+	// 再送できる(dead)送信と、送信済みの送信
+	deadDeliveryID      = 1
+	succeededDeliveryID = 2
+	fixturePlanID       = "5f0c3a52-8f5e-4c1e-9a57-3c9e2f4b7d10"
+)
+
+// 管理者の注文 (order_id → ステータス)
+var fixtureOrders = map[int64]string{
+	1: model.OrderStatusCompleted,
+	2: model.OrderStatusShipping,
+}
+
+// fakeDBの規則
+func fixtureRules() ([]queryRule, error) {
+	passwordHash, err := utils.HashPasswordPBKDF2(fixturePassword)
+	if err != nil {
+		return nil, err
+	}
+	arrivedAt := fixtureTime.Add(2 * time.Hour)
+
+	userRow := func(u fixtureUser) []driver.Value {
+		return []driver.Value{int64(u.id), passwordHash, u.name, u.role}
+	}
+	findUser := func(match func(fixtureUser) bool) [][]driver.Value {
+		for _, u := range fixtureUsers {
+			if match(u) {
+				return [][]driver.Value{userRow(u)}
+			}
+		}
+		return nil
+	}
+	// 管理者の注文のうちargsに含まれるもの (IN句の引数)
+	ownedOrders := func(args []driver.Value) []int64 {
+		var ids []int64
+		for _, a := range args {
+			if id := argInt(a); fixtureOrders[id] != "" && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	return []queryRule{
+		// ユーザー・セッション
+		selectRule(`^SELECT user_id, password_hash, user_name, role FROM users WHERE user_name = \?`,
+			[]string{"user_id", "password_hash", "user_name", "role"},
+			func(args []driver.Value) [][]driver.Value {
+				return findUser(func(u fixtureUser) bool { return u.name == args[0] })
+			}),
+		selectRule(`^SELECT user_id, password_hash, user_name, role FROM users WHERE user_id = \?`,
+			[]string{"user_id", "password_hash", "user_name", "role"},
+			func(args []driver.Value) [][]driver.Value {
+				return findUser(func(u fixtureUser) bool { return int64(u.id) == argInt(args[0]) })
+			}),
+		selectRule(`^SELECT u\.user_id, u\.user_name, u\.role FROM users u JOIN user_sessions s`,
+			[]string{"user_id", "user_name", "role"},
+			func(args []driver.Value) [][]driver.Value {
+				for _, u := range fixtureUsers {
+					if u.session == args[0] {
+						return [][]driver.Value{{int64(u.id), u.name, u.role}}
+					}
+				}
+				return nil
+			}),
+		selectRule(`^SELECT user_id, expires_at FROM user_sessions WHERE session_uuid = \?`,
+			[]string{"user_id", "expires_at"},
+			func(args []driver.Value) [][]driver.Value {
+				for _, u := range fixtureUsers {
+					if u.session == args[0] {
+						return [][]driver.Value{{int64(u.id), time.Now().Add(time.Hour)}}
+					}
+				}
+				return nil
+			}),
+		selectRule(`^SELECT session_uuid FROM user_sessions WHERE user_id = \? AND session_uuid <> \?`,
+			[]string{"session_uuid"},
+			rows([]driver.Value{"00000000-0000-4000-8000-0000000000ff"})),
+		execRule(`^INSERT INTO users `, func(db *fakeDB, args []driver.Value) (driver.Result, error) {
+			if findUser(func(u fixtureUser) bool { return u.name == args[1] }) != nil {
+				return nil, &mysql.MySQLError{Number: 1062, Message: fmt.Sprintf("Duplicate entry '%v' for key 'users.user_name'", args[1])}
+			}
+			return fakeResult{lastInsertID: db.nextID(), rowsAffected: 1}, nil
+		}),
+
+		// APIトークン
+		selectRule(`^SELECT t\.token_id, t\.user_id, u\.role, t\.scopes FROM api_tokens t JOIN users u`,
+			[]string{"token_id", "user_id", "role", "scopes"},
+			func(args []driver.Value) [][]driver.Value {
+				for _, t := range fixtureTokens {
+					if utils.HashAPIToken(t.plain) == args[0] {
+						return [][]driver.Value{{t.id, int64(adminUser.id), adminUser.role, t.scopes}}
+					}
+				}
+				return nil
+			}),
+		selectRule(`^SELECT token_id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at, revoked_at FROM api_tokens`,
+			[]string{"token_id", "user_id", "name", "token_prefix", "scopes", "created_at", "last_used_at", "expires_at", "revoked_at"},
+			rows(
+				[]driver.Value{revokedTokenID, int64(adminUser.id), "old script", "wht_Ab3dE9", "orders:read", fixtureTime, nil, nil, fixtureTime.Add(time.Hour)},
+				[]driver.Value{ordersReadToken.id, int64(adminUser.id), "dashboard", ordersReadToken.plain[:10], ordersReadToken.scopes, fixtureTime, arrivedAt, fixtureTime.AddDate(0, 0, 30), nil},
+				[]driver.Value{allScopesToken.id, int64(adminUser.id), "batch", allScopesToken.plain[:10], allScopesToken.scopes, fixtureTime, nil, nil, nil},
+			)),
+		execRule(`^UPDATE api_tokens SET revoked_at = \? WHERE token_id = \? AND user_id = \?`,
+			affected(func(args []driver.Value) bool {
+				id := argInt(args[1])
+				return argInt(args[2]) == int64(adminUser.id) && (id == allScopesToken.id || id == ordersReadToken.id)
+			})),
+
+		// 商品
+		selectRule(`^SELECT COUNT\(\*\) FROM products`, []string{"COUNT(*)"}, rows([]driver.Value{int64(2)})),
+		selectRule(`^SELECT product_id, name, value, weight, image, description FROM products`,
+			[]string{"product_id", "name", "value", "weight", "image", "description"},
+			rows(
+				[]driver.Value{int64(1), "Tシャツ", int64(1500), int64(3), "images/1.png", "綿100%"},
+				[]driver.Value{int64(2), "マグカップ", int64(800), int64(5), "images/2.png", "電子レンジ対応"},
+			)),
+
+		// 注文
+		selectRule(`^SELECT COUNT\(\*\) FROM orders o JOIN products p`, []string{"COUNT(*)"}, rows([]driver.Value{int64(2)})),
+		selectRule(`^SELECT o\.order_id, o\.product_id, p\.name AS product_name, o\.shipped_status, o\.created_at, o\.arrived_at FROM orders o`,
+			[]string{"order_id", "product_id", "product_name", "shipped_status", "created_at", "arrived_at"},
+			rows(
+				[]driver.Value{int64(2), int64(2), "マグカップ", fixtureOrders[2], fixtureTime, nil},
+				[]driver.Value{int64(1), int64(1), "Tシャツ", fixtureOrders[1], fixtureTime, arrivedAt},
+			)),
+		selectRule(`^SELECT order_id, user_id FROM orders WHERE order_id IN`,
+			[]string{"order_id", "user_id"},
+			func(args []driver.Value) [][]driver.Value {
+				var out [][]driver.Value
+				for _, id := range ownedOrders(args) {
+					out = append(out, []driver.Value{id, int64(adminUser.id)})
+				}
+				return out
+			}),
+		selectRule(`^SELECT order_id, shipped_status FROM orders WHERE order_id IN \(.*\) FOR UPDATE`,
+			[]string{"order_id", "shipped_status"},
+			func(args []driver.Value) [][]driver.Value {
+				var out [][]driver.Value
+				for _, id := range ownedOrders(args) {
+					out = append(out, []driver.Value{id, fixtureOrders[id]})
+				}
+				return out
+			}),
+		selectRule(`^SELECT o\.order_id, p\.weight, p\.value FROM orders o JOIN products p .* WHERE o\.shipped_status = 'shipping'`,
+			[]string{"order_id", "weight", "value"},
+			rows([]driver.Value{int64(2), int64(5), int64(800)})),
+		selectRule(`^SELECT shipped_status, COUNT\(\*\) AS cnt FROM orders`,
+			[]string{"shipped_status", "cnt"},
+			rows(
+				[]driver.Value{model.OrderStatusShipping, int64(1)},
+				[]driver.Value{model.OrderStatusCompleted, int64(1)},
+			)),
+		selectRule(`^SELECT event_id, order_id, event_type, from_status, to_status, actor_type, actor_id, plan_id, occurred_at FROM order_events`,
+			[]string{"event_id", "order_id", "event_type", "from_status", "to_status", "actor_type", "actor_id", "plan_id", "occurred_at"},
+			func(args []driver.Value) [][]driver.Value {
+				id := argInt(args[0])
+				if id != 1 {
+					return nil
+				}
+				return [][]driver.Value{
+					{int64(10), id, model.OrderEventCreated, nil, model.OrderStatusShipping, model.OrderActorUser, "1", nil, fixtureTime},
+					{int64(11), id, model.OrderEventClaimed, model.OrderStatusShipping, model.OrderStatusDelivering, model.OrderActorRobot, "robot-001", fixturePlanID, fixtureTime.Add(time.Hour)},
+					{int64(12), id, model.OrderEventArrived, model.OrderStatusDelivering, model.OrderStatusCompleted, model.OrderActorRobot, "robot-001", nil, arrivedAt},
+				}
+			}),
+
+		// Webhook
+		selectRule(`^SELECT webhook_id, user_id, url, event_types, active, created_at FROM webhooks WHERE webhook_id = \? AND user_id = \?`,
+			[]string{"webhook_id", "user_id", "url", "event_types", "active", "created_at"},
+			func(args []driver.Value) [][]driver.Value {
+				if argInt(args[0]) != fixtureWebhookID || argInt(args[1]) != int64(adminUser.id) {
+					return nil
+				}
+				return [][]driver.Value{fixtureWebhookRow()}
+			}),
+		selectRule(`^SELECT webhook_id, user_id, url, event_types, active, created_at FROM webhooks WHERE user_id = \?`,
+			[]string{"webhook_id", "user_id", "url", "event_types", "active", "created_at"},
+			func(args []driver.Value) [][]driver.Value {
+				if argInt(args[0]) != int64(adminUser.id) {
+					return nil
+				}
+				return [][]driver.Value{fixtureWebhookRow()}
+			}),
+		selectRule(`^SELECT COUNT\(\*\) FROM webhooks WHERE user_id = \?`, []string{"COUNT(*)"}, rows([]driver.Value{int64(1)})),
+		execRule(`^DELETE FROM webhooks WHERE webhook_id = \? AND user_id = \?`,
+			affected(func(args []driver.Value) bool {
+				return argInt(args[0]) == fixtureWebhookID && argInt(args[1]) == int64(adminUser.id)
+			})),
+		selectRule(`^SELECT w\.webhook_id, w\.event_types, o\.order_id, o\.product_id, o\.shipped_status, o\.created_at, o\.arrived_at FROM orders o JOIN webhooks w`,
+			[]string{"webhook_id", "event_types", "order_id", "product_id", "shipped_status", "created_at", "arrived_at"},
+			func(args []driver.Value) [][]driver.Value {
+				var out [][]driver.Value
+				for _, id := range ownedOrders(args) {
+					out = append(out, []driver.Value{int64(fixtureWebhookID), "order.created order.delivering order.arrived", id, id, fixtureOrders[id], fixtureTime, nil})
+				}
+				return out
+			}),
+		selectRule(`^SELECT delivery_id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at FROM webhook_deliveries WHERE webhook_id = \?`,
+			[]string{"delivery_id", "webhook_id", "event_id", "event_type", "payload", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"},
+			rows(
+				[]driver.Value{int64(succeededDeliveryID), int64(fixtureWebhookID), "0d6f7c2e-3b8a-4f51-9c1d-7e2a5b4c3d21", model.WebhookEventOrderArrived,
+					webhookPayload("0d6f7c2e-3b8a-4f51-9c1d-7e2a5b4c3d21", model.WebhookEventOrderArrived, model.OrderStatusCompleted, &arrivedAt),
+					model.WebhookDeliverySucceeded, int64(1), arrivedAt, int64(204), nil, arrivedAt, arrivedAt},
+				[]driver.Value{int64(deadDeliveryID), int64(fixtureWebhookID), "6a1e2d3c-4b5a-4c6d-8e7f-9a0b1c2d3e4f", model.WebhookEventOrderCreated,
+					webhookPayload("6a1e2d3c-4b5a-4c6d-8e7f-9a0b1c2d3e4f", model.WebhookEventOrderCreated, model.OrderStatusShipping, nil),
+					model.WebhookDeliveryDead, int64(8), fixtureTime, int64(500), "unexpected status 500", fixtureTime, nil},
+			)),
+		execRule(`^UPDATE webhook_deliveries SET status = \?, attempts = 0, next_attempt_at = \? WHERE delivery_id = \? AND webhook_id = \? AND status = \?`,
+			affected(func(args []driver.Value) bool {
+				return argInt(args[2]) == deadDeliveryID && argInt(args[3]) == fixtureWebhookID
+			})),
+
+		// 配送統計
+		selectRule(`^SELECT COUNT\(\*\) AS delivered, AVG\(secs\) AS avg_seconds`,
+			[]string{"delivered", "avg_seconds", "median_seconds", "p95_seconds"},
+			rows([]driver.Value{int64(1), float64(7200), int64(7200), int64(7200)})),
+		selectRule(`^SELECT v\.product_id, p\.name, v\.orders, v\.delivered FROM`,
+			[]string{"product_id", "name", "orders", "delivered"},
+			rows(
+				[]driver.Value{int64(1), "Tシャツ", int64(1), int64(1)},
+				[]driver.Value{int64(2), "マグカップ", int64(1), int64(0)},
+			)),
+		selectRule(`^SELECT robot_id, SUM\(plans\) AS plans`,
+			[]string{"robot_id", "plans", "orders", "delivered", "total_weight", "total_capacity"},
+			rows([]driver.Value{"robot-001", int64(1), int64(1), int64(1), int64(3), int64(10)})),
+
+		// スキーマのバージョン
+		selectRule(`^SELECT MAX\(version\) FROM schema_migrations`, []string{"MAX(version)"}, rows([]driver.Value{int64(12)})),
+	}, nil
+}
+
+func fixtureWebhookRow() []driver.Value {
+	return []driver.Value{int64(fixtureWebhookID), int64(adminUser.id), "https://hooks.example.com/orders",
+		"order.created order.arrived", true, fixtureTime}
+}
+
+func webhookPayload(id, eventType, status string, arrivedAt *time.Time) []byte {
+	arrived := "null"
+	if arrivedAt != nil {
+		arrived = `"` + arrivedAt.Format(time.RFC3339) + `"`
+	}
+	return fmt.Appendf(nil, `{"id":%q,"type":%q,"created_at":%q,"data":{"order_id":1,"product_id":1,"shipped_status":%q,"created_at":%q,"arrived_at":%s}}`,
+		id, eventType, fixtureTime.Format(time.RFC3339), status, fixtureTime.Format(time.RFC3339), arrived)
+}
+
+func selectRule(pattern string, columns []string, rows func(args []driver.Value) [][]driver.Value) queryRule {
+	return queryRule{pattern: regexp.MustCompile(pattern), columns: columns, rows: rows}
+}
+
+func execRule(pattern string, exec func(db *fakeDB, args []driver.Value) (driver.Result, error)) queryRule {
+	return queryRule{pattern: regexp.MustCompile(pattern), exec: exec}
+}
+
+// 引数によらず同じ行を返す
+func rows(rs ...[]driver.Value) func([]driver.Value) [][]driver.Value {
+	return func([]driver.Value) [][]driver.Value { return rs }
+}
+
+// 条件に一致すれば1行、しなければ0行を変更したものとする
+func affected(match func(args []driver.Value) bool) func(*fakeDB, []driver.Value) (driver.Result, error) {
+	return func(_ *fakeDB, args []driver.Value) (driver.Result, error) {
+		if match(args) {
+			return fakeResult{rowsAffected: 1}, nil
+		}
+		return fakeResult{}, nil
+	}
+}
+
+func argInt(v driver.Value) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case string:
+		var i int64
+		fmt.Sscan(n, &i)
+		return i
+	}
+	return 0
+}
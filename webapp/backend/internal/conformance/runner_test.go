@@ -0,0 +1,469 @@
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/middleware"
+	"backend/internal/server"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// 画像の取得に使うファイル (一時ディレクトリに作成する)
+	sampleImage = "sample.png"
+	// ブラウザからのリクエストとして送るOrigin
+	// 信頼済みのOriginとして扱われないよう、設定にない値にする
+	browserOrigin = "https://conformance.invalid"
+	csrfToken     = "conformance-csrf-token"
+	jsonType      = "application/json"
+	// SSEでイベントを待つ時間
+	eventTimeout = 3 * time.Second
+)
+
+// 1つの確認の結果
+type Result struct {
+	Name   string
+	Errors []string
+}
+
+// fakeDBを使うサーバーを起動し、リクエストを送るrunnerを返す
+// ケースは同じfakeDBを使うため、順番に実行すること
+func start(cfg *config.Config, spec *Spec, logger *slog.Logger) (*runner, func(), error) {
+	rules, err := fixtureRules()
+	if err != nil {
+		return nil, nil, fmt.Errorf("build fixtures: %w", err)
+	}
+	fake := newFakeDB(rules)
+
+	imageDir, err := os.MkdirTemp("", "conformance-images-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create image dir: %w", err)
+	}
+	if err := writeSampleImage(filepath.Join(imageDir, sampleImage)); err != nil {
+		os.RemoveAll(imageDir)
+		return nil, nil, err
+	}
+
+	// バックグラウンドの処理や外部への送信を行わないようにする
+	c := *cfg
+	c.ImageDir = imageDir
+	c.Metrics.Enabled = false
+	c.Webhook.DispatcherEnabled = false
+	c.Server.DrainDelay = 0
+
+	srv, err := server.NewServerWithConnections(&c, logger, fake.open(), nil, nil)
+	if err != nil {
+		os.RemoveAll(imageDir)
+		return nil, nil, fmt.Errorf("initialize server: %w", err)
+	}
+	ts := httptest.NewServer(srv.Router)
+	stop := func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		os.RemoveAll(imageDir)
+	}
+
+	r := &runner{
+		spec:    spec,
+		fake:    fake,
+		router:  srv.Router,
+		baseURL: ts.URL,
+		apiKey:  c.Auth.RobotAPIKey,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		covered: map[string]bool{},
+	}
+	return r, stop, nil
+}
+
+type runner struct {
+	spec    *Spec
+	fake    *fakeDB
+	router  chi.Routes
+	baseURL string
+	apiKey  string
+	client  *http.Client
+	// 2xxを確認できたオペレーション ("GET /api/v1/tokens")
+	covered map[string]bool
+}
+
+func operationKey(method, path string) string {
+	return method + " " + path
+}
+
+// ルーターのルートと定義のオペレーションが一致するか
+func (r *runner) checkRoutes() Result {
+	res := Result{Name: "routes match the spec"}
+	routes := map[string]bool{}
+	err := chi.Walk(r.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// /metricsは外部に公開しない
+		if route != "/metrics" {
+			routes[operationKey(method, route)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		res.Errors = append(res.Errors, "walk routes: "+err.Error())
+		return res
+	}
+	documented := map[string]bool{}
+	for _, op := range r.spec.Operations() {
+		key := operationKey(op.Method, op.Path)
+		documented[key] = true
+		if !routes[key] {
+			res.Errors = append(res.Errors, key+": documented but not routed")
+		}
+	}
+	var undocumented []string
+	for key := range routes {
+		if !documented[key] {
+			undocumented = append(undocumented, key+": routed but not documented")
+		}
+	}
+	sort.Strings(undocumented)
+	res.Errors = append(res.Errors, undocumented...)
+	return res
+}
+
+// 全てのオペレーションについて2xxのレスポンスを確認できたか
+func (r *runner) checkCoverage() Result {
+	res := Result{Name: "every operation has a successful case"}
+	for _, op := range r.spec.Operations() {
+		if key := operationKey(op.Method, op.Path); !r.covered[key] {
+			res.Errors = append(res.Errors, key+": no passing 2xx case")
+		}
+	}
+	return res
+}
+
+// 1つのケースを実行した結果
+func (r *runner) check(tc Case) Result {
+	return Result{
+		Name:   fmt.Sprintf("%s %s: %s", tc.Method, tc.Path, tc.Name),
+		Errors: r.run(tc),
+	}
+}
+
+// 1つのケースを実行し、定義とのずれを返す
+func (r *runner) run(tc Case) []string {
+	var errs []string
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	path, _, _ := strings.Cut(tc.Path, "?")
+	op, ok := r.spec.FindOperation(tc.Method, path)
+	if !ok {
+		if op.Path == "" {
+			fail("path is not documented")
+		} else {
+			fail("method is not documented for %s", op.Path)
+		}
+		return errs
+	}
+
+	body, err := r.requestBody(op, tc)
+	if err != nil {
+		fail("%v", err)
+		return errs
+	}
+	errs = append(errs, r.checkRequestBody(op, tc, body)...)
+
+	var failQuery *regexp.Regexp
+	if tc.FailQuery != "" {
+		failQuery = regexp.MustCompile(tc.FailQuery)
+	}
+	r.fake.reset(failQuery)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if tc.Method == http.MethodGet {
+		// SSEのストリームは終わらないため、読み込みに上限を設ける
+		ctx, cancel = context.WithTimeout(ctx, eventTimeout)
+		defer cancel()
+	}
+	resp, err := r.do(ctx, tc, body)
+	if err != nil {
+		fail("request failed: %v", err)
+		return errs
+	}
+	defer resp.Body.Close()
+
+	var respBody []byte
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" && resp.StatusCode == http.StatusOK {
+		errs = append(errs, r.readEvents(op, resp, tc)...)
+	} else if respBody, err = io.ReadAll(resp.Body); err != nil {
+		fail("read response: %v", err)
+		return errs
+	}
+
+	if resp.StatusCode != tc.Status {
+		fail("status %d, want %d (body: %s)", resp.StatusCode, tc.Status, snippet(respBody))
+	}
+	errs = append(errs, r.checkResponse(op, resp, respBody)...)
+	for _, q := range r.fake.takeUnmatched() {
+		fail("no fixture for query: %s", q)
+	}
+
+	if len(errs) == 0 && resp.StatusCode/100 == 2 {
+		r.covered[operationKey(op.Method, op.Path)] = true
+	}
+	return errs
+}
+
+// 送信するボディ
+// ケースで指定していない場合は、必須のボディのみ定義の例から生成する
+func (r *runner) requestBody(op Operation, tc Case) ([]byte, error) {
+	switch b := tc.Body.(type) {
+	case string:
+		return []byte(b), nil
+	case nil:
+		schemas, required := r.spec.RequestBody(op)
+		schema, ok := schemas[jsonType]
+		if !required || !ok {
+			return nil, nil
+		}
+		return json.Marshal(r.spec.Example(schema))
+	default:
+		return json.Marshal(b)
+	}
+}
+
+// リクエストボディが定義に適合するか
+// 成功を期待するケースは適合すること、Invalidのケースは違反していることを確認する
+func (r *runner) checkRequestBody(op Operation, tc Case, body []byte) []string {
+	schemas, required := r.spec.RequestBody(op)
+	var violations []string
+	switch {
+	case len(body) == 0:
+		if required {
+			violations = []string{"request body is required"}
+		}
+	case schemas == nil:
+		violations = []string{"request body is not documented"}
+	default:
+		schema, ok := schemas[jsonType]
+		if !ok {
+			violations = []string{jsonType + " request body is not documented"}
+		} else {
+			violations = r.spec.ValidateJSON(body, schema)
+		}
+	}
+
+	if tc.Invalid {
+		if len(violations) == 0 {
+			return []string{"request body is rejected by the server but valid in the spec"}
+		}
+		return nil
+	}
+	if tc.Status/100 != 2 {
+		return nil
+	}
+	errs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		errs = append(errs, "request: "+v)
+	}
+	return errs
+}
+
+func (r *runner) do(ctx context.Context, tc Case, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, tc.Method, r.baseURL+tc.Path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", jsonType)
+	}
+
+	switch tc.Auth {
+	case authAdmin, authManager, authOperator:
+		// ブラウザからのリクエストとして、CSRFトークンも送る
+		for _, u := range fixtureUsers {
+			if u.name == string(tc.Auth) {
+				req.AddCookie(&http.Cookie{Name: "session_id", Value: u.session})
+			}
+		}
+		req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: csrfToken})
+		req.Header.Set(middleware.CSRFHeaderName, csrfToken)
+		req.Header.Set("Origin", browserOrigin)
+	case authToken:
+		req.Header.Set("Authorization", "Bearer "+allScopesToken.plain)
+	case authReadToken:
+		req.Header.Set("Authorization", "Bearer "+ordersReadToken.plain)
+	case authRobot:
+		req.Header.Set("X-API-KEY", r.apiKey)
+	}
+	for k, v := range tc.Header {
+		req.Header.Set(k, v)
+	}
+	return r.client.Do(req)
+}
+
+// ステータスコード・Content-Type・ボディが定義と一致するか
+func (r *runner) checkResponse(op Operation, resp *http.Response, body []byte) []string {
+	var errs []string
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	def, ok := r.spec.Response(op, resp.StatusCode)
+	if !ok {
+		fail("status %d is not documented", resp.StatusCode)
+		return errs
+	}
+	schemas := r.spec.contentSchemas(def)
+	if len(schemas) == 0 {
+		if len(body) > 0 {
+			fail("response has a body but none is documented: %s", snippet(body))
+		}
+		return errs
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		fail("invalid Content-Type %q", contentType)
+		return errs
+	}
+	schema, ok := schemas[mediaType]
+	if !ok {
+		documented := make([]string, 0, len(schemas))
+		for m := range schemas {
+			documented = append(documented, m)
+		}
+		sort.Strings(documented)
+		fail("Content-Type %q is not documented (documented: %s)", mediaType, strings.Join(documented, ", "))
+		return errs
+	}
+	if schema == nil {
+		return errs
+	}
+
+	switch mediaType {
+	case "application/json":
+		for _, v := range r.spec.ValidateJSON(body, schema) {
+			fail("response: %s", v)
+		}
+	case "application/x-ndjson":
+		// 1行が1つの値
+		lines := bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n"))
+		for i, line := range lines {
+			if len(line) == 0 {
+				continue
+			}
+			for _, v := range r.spec.ValidateJSON(line, schema) {
+				fail("response line %d: %s", i+1, v)
+			}
+		}
+	}
+	return errs
+}
+
+// SSEのイベントを読み、Triggerのリクエストで発生したイベントが定義に適合するかを確認する
+// Triggerがなければ最初のイベント (retry) まで、あればorder_statusのイベントを受け取るまで読む
+func (r *runner) readEvents(op Operation, resp *http.Response, tc Case) []string {
+	var errs []string
+	def, _ := r.spec.Response(op, resp.StatusCode)
+	schema := r.spec.contentSchemas(def)["text/event-stream"]
+
+	if tc.Trigger != nil {
+		// 購読はヘッダーを返す前に済んでいる
+		for _, e := range r.run(*tc.Trigger) {
+			errs = append(errs, "trigger "+tc.Trigger.Name+": "+e)
+		}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	first, received := true, false
+	var name string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if first && tc.Trigger == nil {
+				break
+			}
+			first = false
+			name = ""
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// コメント
+		case "retry":
+			if !first {
+				errs = append(errs, "retry is sent after the first event")
+			}
+		case "event":
+			name = value
+		case "data":
+			if name != "order_status" {
+				continue
+			}
+			received = true
+			if schema != nil {
+				for _, v := range r.spec.ValidateJSON([]byte(value), schema) {
+					errs = append(errs, "event: "+v)
+				}
+			}
+		case "id":
+		default:
+			errs = append(errs, fmt.Sprintf("unknown event field %q", field))
+		}
+		if received {
+			break
+		}
+	}
+	if tc.Trigger != nil && !received {
+		errs = append(errs, "no order_status event received within "+eventTimeout.String())
+	}
+	return errs
+}
+
+func writeSampleImage(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create sample image: %w", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		return fmt.Errorf("encode sample image: %w", err)
+	}
+	return f.Close()
+}
+
+// エラーメッセージに含めるボディの先頭部分
+func snippet(body []byte) string {
+	const limit = 200
+	s := strings.TrimSpace(string(body))
+	if len(s) > limit {
+		s = s[:limit] + "..."
+	}
+	return s
+}
@@ -0,0 +1,328 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// JSONの値がスキーマに適合するかを検証し、違反を "フィールドのパス: 理由" の形式で返す
+//
+// 対応するキーワードはtype, nullable, enum, required, properties, additionalProperties,
+// items, minItems, maxItems, minimum, maximum, minLength, maxLength, format(date-time, uuid), allOf。
+// ハンドラーが定義にないフィールドを返した場合や、未知のフィールドを受け付けないリクエストとの
+// ずれを検出するため、propertiesを持つオブジェクトはadditionalPropertiesの指定がなければ
+// 定義にないプロパティを許可しない。
+// vはjson.Decoder.UseNumberでデコードした値を渡すこと
+func (s *Spec) Validate(v any, schema map[string]any) []string {
+	var errs []string
+	s.validate(v, schema, "$", &errs)
+	return errs
+}
+
+// JSONのバイト列を検証する
+func (s *Spec) ValidateJSON(data []byte, schema map[string]any) []string {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return []string{"$: invalid JSON: " + err.Error()}
+	}
+	return s.Validate(v, schema)
+}
+
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+func (s *Spec) validate(v any, schema map[string]any, path string, errs *[]string) {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return
+	}
+	if all, ok := schema["allOf"].([]any); ok {
+		schema = s.mergeAllOf(schema, all)
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if v == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable {
+			fail("must not be null")
+		}
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !inEnum(v, enum) {
+		fail("%s is not one of %s", jsonText(v), jsonText(enum))
+		return
+	}
+
+	switch typ, _ := schema["type"].(string); typ {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("must be an object, got %s", jsonText(v))
+			return
+		}
+		s.validateObject(obj, schema, path, errs)
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			fail("must be an array, got %s", jsonText(v))
+			return
+		}
+		if n, ok := intKeyword(schema, "minItems"); ok && int64(len(arr)) < n {
+			fail("must have at least %d items", n)
+		}
+		if n, ok := intKeyword(schema, "maxItems"); ok && int64(len(arr)) > n {
+			fail("must have at most %d items", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, e := range arr {
+				s.validate(e, items, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string, got %s", jsonText(v))
+			return
+		}
+		if n, ok := intKeyword(schema, "minLength"); ok && int64(utf8.RuneCountInString(str)) < n {
+			fail("must be at least %d characters", n)
+		}
+		if n, ok := intKeyword(schema, "maxLength"); ok && int64(utf8.RuneCountInString(str)) > n {
+			fail("must be at most %d characters", n)
+		}
+		switch schema["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				fail("%q is not an RFC3339 date-time", str)
+			}
+		case "uuid":
+			if !uuidPattern.MatchString(str) {
+				fail("%q is not a UUID", str)
+			}
+		}
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			fail("must be a %s, got %s", typ, jsonText(v))
+			return
+		}
+		f, err := num.Float64()
+		if err != nil {
+			fail("%s is not a number", num)
+			return
+		}
+		if typ == "integer" {
+			if _, err := num.Int64(); err != nil {
+				fail("%s is not an integer", num)
+				return
+			}
+		}
+		if min, ok := numberKeyword(schema, "minimum"); ok && f < min {
+			fail("%s is less than the minimum %v", num, min)
+		}
+		if max, ok := numberKeyword(schema, "maximum"); ok && f > max {
+			fail("%s is greater than the maximum %v", num, max)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean, got %s", jsonText(v))
+		}
+	}
+}
+
+func (s *Spec) validateObject(obj map[string]any, schema map[string]any, path string, errs *[]string) {
+	props, _ := schema["properties"].(map[string]any)
+	for _, name := range stringList(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if prop, ok := props[k].(map[string]any); ok {
+			s.validate(obj[k], prop, path+"."+k, errs)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case map[string]any:
+			s.validate(obj[k], additional, path+"."+k, errs)
+		case bool:
+			if !additional {
+				*errs = append(*errs, fmt.Sprintf("%s: undocumented property %q", path, k))
+			}
+		case nil:
+			// propertiesのないオブジェクトは内容を定義していないものとして扱う
+			if props != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: undocumented property %q", path, k))
+			}
+		}
+	}
+}
+
+// allOfのスキーマを1つのオブジェクトのスキーマにまとめる
+// 各スキーマを個別に検証すると、他方のプロパティが定義にないものとして扱われるため
+func (s *Spec) mergeAllOf(schema map[string]any, all []any) map[string]any {
+	merged := map[string]any{}
+	props := map[string]any{}
+	var required []any
+	parts := append([]any{schema}, all...)
+	for i, part := range parts {
+		m, ok := part.(map[string]any)
+		if !ok {
+			continue
+		}
+		m = s.resolve(m)
+		if nested, ok := m["allOf"].([]any); ok && i > 0 {
+			m = s.mergeAllOf(m, nested)
+		}
+		for k, v := range m {
+			switch k {
+			case "allOf":
+			case "properties":
+				p, _ := v.(map[string]any)
+				for name, prop := range p {
+					props[name] = prop
+				}
+			case "required":
+				r, _ := v.([]any)
+				required = append(required, r...)
+			default:
+				merged[k] = v
+			}
+		}
+	}
+	merged["properties"] = props
+	merged["required"] = required
+	if _, ok := merged["type"]; !ok {
+		merged["type"] = "object"
+	}
+	return merged
+}
+
+// スキーマに適合する値を生成する (リクエストボディの既定値に使う)
+// example, default, enumの先頭の順に使い、なければ型と制約から作る。
+// オブジェクトは必須のプロパティのみを含める
+func (s *Spec) Example(schema map[string]any) any {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	if all, ok := schema["allOf"].([]any); ok {
+		schema = s.mergeAllOf(schema, all)
+	}
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return v
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch schema["type"] {
+	case "object":
+		props, _ := schema["properties"].(map[string]any)
+		obj := map[string]any{}
+		for _, name := range stringList(schema["required"]) {
+			prop, _ := props[name].(map[string]any)
+			obj[name] = s.Example(prop)
+		}
+		return obj
+	case "array":
+		n, _ := intKeyword(schema, "minItems")
+		items, _ := schema["items"].(map[string]any)
+		arr := make([]any, 0, n)
+		for range n {
+			arr = append(arr, s.Example(items))
+		}
+		return arr
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		case "uuid":
+			return "00000000-0000-4000-8000-000000000000"
+		}
+		n, _ := intKeyword(schema, "minLength")
+		return strings.Repeat("x", int(max(n, 1)))
+	case "integer", "number":
+		if min, ok := numberKeyword(schema, "minimum"); ok {
+			return min
+		}
+		return 1
+	case "boolean":
+		return true
+	}
+	return nil
+}
+
+func inEnum(v any, enum []any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func intKeyword(schema map[string]any, key string) (int64, bool) {
+	f, ok := numberKeyword(schema, key)
+	return int64(f), ok
+}
+
+func numberKeyword(schema map[string]any, key string) (float64, bool) {
+	switch n := schema[key].(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func stringList(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// エラーメッセージ用の短いJSON表現
+func jsonText(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(b) > 80 {
+		return string(b[:77]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,239 @@
+// OpenAPIの定義とサーバーの実装のずれを検出する
+//
+// このパッケージはOpenAPIの定義の読み込みとJSONの検証のみを持ち、検証自体はテストで行う。
+// テストでは固定のデータを返すfakeDBでサーバーを起動し、Casesのリクエストを送って
+// ステータスコード・Content-Type・リクエストとレスポンスのボディが定義と一致するかを確認する。
+// あわせて、ルーターに登録されたルートと定義のオペレーションが過不足なく対応しているかも確認する。
+// MySQL・Redisは不要なため、CIでは go test ./internal/conformance/ で実行できる
+package conformance
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIの定義
+// 検証に使う部分のみを扱うため、YAMLをそのままmapとして保持する
+type Spec struct {
+	doc   map[string]any
+	paths []specPath
+}
+
+// パステンプレート (/api/v1/orders/{orderID}/timeline) と実際のパスの対応
+type specPath struct {
+	template string
+	pattern  *regexp.Regexp
+	// パラメータを含まないパスを優先して照合するため
+	literal bool
+	item    map[string]any
+}
+
+// 1つのオペレーション (メソッドとパスの組)
+type Operation struct {
+	Method string
+	Path   string
+	node   map[string]any
+}
+
+// OpenAPIで使えるHTTPメソッド (pathsの要素のうちこれ以外はparametersなど)
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+var pathParamPattern = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// OpenAPIの定義ファイルを読み込む
+// 全ての$refが解決できることもあわせて確認する
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read spec: %w", err)
+	}
+	return ParseSpec(data)
+}
+
+func ParseSpec(data []byte) (*Spec, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+	s := &Spec{doc: doc}
+	if err := s.checkRefs(doc, "#"); err != nil {
+		return nil, err
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("spec has no paths")
+	}
+	for template, v := range paths {
+		item, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("paths.%s must be an object", template)
+		}
+		s.paths = append(s.paths, specPath{
+			template: template,
+			pattern:  templatePattern(template),
+			literal:  !strings.Contains(template, "{"),
+			item:     item,
+		})
+	}
+	sort.Slice(s.paths, func(i, j int) bool {
+		if s.paths[i].literal != s.paths[j].literal {
+			return s.paths[i].literal
+		}
+		return s.paths[i].template < s.paths[j].template
+	})
+	return s, nil
+}
+
+// パステンプレートのパラメータ部分を任意のセグメントに一致させる
+func templatePattern(template string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range pathParamPattern.FindAllStringIndex(template, -1) {
+		b.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		b.WriteString(`[^/]+`)
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[last:]))
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// 定義されている全てのオペレーション (パス・メソッド順)
+func (s *Spec) Operations() []Operation {
+	var ops []Operation
+	for _, p := range s.paths {
+		for _, method := range operationMethods {
+			if node, ok := p.item[method].(map[string]any); ok {
+				ops = append(ops, Operation{Method: strings.ToUpper(method), Path: p.template, node: node})
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// 実際のリクエストのパスとメソッドに対応するオペレーション
+// パスが定義されていない場合はokがfalse、パスはあるがメソッドがない場合はPathのみ設定して返す
+func (s *Spec) FindOperation(method, path string) (Operation, bool) {
+	for _, p := range s.paths {
+		if !p.pattern.MatchString(path) {
+			continue
+		}
+		node, ok := p.item[strings.ToLower(method)].(map[string]any)
+		return Operation{Method: method, Path: p.template, node: node}, ok
+	}
+	return Operation{}, false
+}
+
+// ステータスコードに対応するレスポンスの定義
+func (s *Spec) Response(op Operation, status int) (map[string]any, bool) {
+	responses, _ := op.node["responses"].(map[string]any)
+	v, ok := responses[fmt.Sprint(status)]
+	if !ok {
+		// 2XXのような範囲指定
+		v, ok = responses[fmt.Sprintf("%dXX", status/100)]
+	}
+	if !ok {
+		return nil, false
+	}
+	node, _ := v.(map[string]any)
+	return s.resolve(node), true
+}
+
+// リクエストボディのメディアタイプごとのスキーマ
+// リクエストボディが定義されていない場合はnil
+func (s *Spec) RequestBody(op Operation) (schemas map[string]map[string]any, required bool) {
+	body, ok := op.node["requestBody"].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	body = s.resolve(body)
+	required, _ = body["required"].(bool)
+	return s.contentSchemas(body), required
+}
+
+// レスポンスまたはリクエストボディのcontentをメディアタイプごとのスキーマにする
+// スキーマのないメディアタイプはnilのスキーマになる
+func (s *Spec) contentSchemas(node map[string]any) map[string]map[string]any {
+	content, _ := node["content"].(map[string]any)
+	schemas := make(map[string]map[string]any, len(content))
+	for mediaType, v := range content {
+		media, _ := v.(map[string]any)
+		schema, _ := media["schema"].(map[string]any)
+		schemas[mediaType] = schema
+	}
+	return schemas
+}
+
+// $refをたどって参照先のノードを返す
+func (s *Spec) resolve(node map[string]any) map[string]any {
+	for i := 0; node != nil && i < 32; i++ {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		node, _ = s.lookup(ref)
+	}
+	return node
+}
+
+// #/components/schemas/Order のようなドキュメント内の参照
+func (s *Spec) lookup(ref string) (map[string]any, bool) {
+	rest, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, false
+	}
+	var cur any = s.doc
+	for _, key := range strings.Split(rest, "/") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		key = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	node, ok := cur.(map[string]any)
+	return node, ok
+}
+
+func (s *Spec) checkRefs(v any, at string) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if _, found := s.lookup(ref); !found {
+				return fmt.Errorf("%s: unresolvable $ref %q", at, ref)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := s.checkRefs(v[k], at+"/"+k); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if err := s.checkRefs(e, fmt.Sprintf("%s/%d", at, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,29 +1,21 @@
 package db
 
 import (
+	"backend/internal/config"
 	"backend/internal/telemetry"
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
-func InitDBConnection() (*sqlx.DB, error) {
-	dbUrl := os.Getenv("DATABASE_URL")
-	if dbUrl == "" {
-		dbUrl = "user:password@tcp(db:4306)/42Tokyo2508-db"
-	}
-	dsn := fmt.Sprintf("%s?charset=utf8mb4&parseTime=True&loc=Local", dbUrl)
-	log.Printf(dsn)
-
-	driverName := telemetry.WrapSQLDriver("mysql")
-	dbConn, err := sqlx.Open(driverName, dsn)
+func InitDBConnection(cfg config.DatabaseConfig) (*sqlx.DB, error) {
+	dbConn, err := open(cfg.URL, cfg)
 	if err != nil {
-		log.Printf("Failed to open database connection: %v", err)
+		slog.Error("failed to open database connection", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
@@ -32,16 +24,28 @@ func InitDBConnection() (*sqlx.DB, error) {
 	err = dbConn.PingContext(ctx)
 	if err != nil {
 		dbConn.Close()
-		log.Printf("Failed to connect to database: %v", err)
+		slog.Error("failed to connect to database", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-	log.Println("Successfully connected to MySQL!")
+	slog.Info("connected to mysql")
+
+	return dbConn, nil
+}
+
+// プライマリ・レプリカで共通の接続設定でコネクションプールを作成する (接続はまだ行わない)
+func open(url string, cfg config.DatabaseConfig) (*sqlx.DB, error) {
+	dsn := fmt.Sprintf("%s?charset=utf8mb4&parseTime=True&loc=Local", url)
 
-	// 接続プール最適化設定
-	dbConn.SetMaxOpenConns(15)              // 最大接続数を削減（VM環境対応）
-	dbConn.SetMaxIdleConns(5)               // アイドル接続数を削減
-	dbConn.SetConnMaxLifetime(5 * time.Minute) // 接続の最大寿命
-	dbConn.SetConnMaxIdleTime(30 * time.Second) // アイドル時間後に接続を閉じる
+	driverName := telemetry.WrapSQLDriver("mysql")
+	dbConn, err := sqlx.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
 
+	// 接続プール設定
+	dbConn.SetMaxOpenConns(cfg.MaxOpenConns)
+	dbConn.SetMaxIdleConns(cfg.MaxIdleConns)
+	dbConn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	dbConn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	return dbConn, nil
 }
@@ -1,33 +1,71 @@
 package db
 
 import (
+	"backend/internal/config"
 	"context"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-var redisClient *redis.Client
+// Redisに接続できない間、コマンドを即座に失敗させるためのエラー
+// 呼び出し側は他のRedisエラーと同様にキャッシュミスとして扱えばよい
+var ErrRedisUnavailable = errors.New("redis unavailable")
+
+var redisClient redis.UniversalClient
 
 // redisClientの初期化
-func InitRedisClient() (*redis.Client, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     "redis:6379", // Dockerネットワーク内のアドレス
-		Password: "",           // パスワードなし
-		DB:       0,            // デフォルトDB
-	})
+// 起動時にRedisへ接続できなくてもクライアントを返し、バックグラウンドで再接続を試みる。
+// 設定が不正な場合(CAファイルが読めない等)のみエラーを返す
+func InitRedisClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		SentinelPassword: cfg.SentinelPassword,
+		DialTimeout:      cfg.DialTimeout,
+	}
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		opts.MasterName = cfg.MasterName
+	case config.RedisModeCluster:
+		opts.IsClusterMode = true
+	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := redisTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	client := redis.NewUniversalClient(opts)
+	avail := &availabilityHook{}
+	client.AddHook(avail)
 
 	// 接続テスト
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := client.Ping(ctx).Result()
-	if err != nil {
-		log.Printf("Redisへの接続に失敗しました: %v", err)
-		return nil, err
+	if err := client.Ping(ctx).Err(); err != nil {
+		slog.Warn("redis connection failed, retrying in background",
+			slog.Duration("reconnect_interval", cfg.ReconnectInterval), slog.Any("error", err))
+	} else {
+		avail.up.Store(true)
+		slog.Info("connected to redis", slog.String("mode", cfg.Mode))
 	}
-	log.Println("Redisに接続しました")
+
+	go monitorRedis(client, avail, cfg.ReconnectInterval)
 
 	// グローバル変数のredisClientにセット
 	redisClient = client
@@ -35,6 +73,88 @@ func InitRedisClient() (*redis.Client, error) {
 }
 
 // グローバル変数のredisClientをこの関数経由で渡すことで一括管理ができる
-func GetRedisClient() *redis.Client {
+func GetRedisClient() redis.UniversalClient {
 	return redisClient
 }
+
+func redisTLSConfig(cfg config.RedisConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if tlsConfig.ServerName == "" && cfg.Mode == config.RedisModeStandalone {
+		if host, _, err := net.SplitHostPort(cfg.Addrs[0]); err == nil {
+			tlsConfig.ServerName = host
+		}
+	}
+	if cfg.TLS.CAFile != "" {
+		pem, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", cfg.TLS.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// 定期的にPINGを送り、Redisの可用性を更新する
+// クライアントがCloseされたら終了する
+func monitorRedis(client redis.UniversalClient, avail *availabilityHook, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := client.Ping(ctx).Err()
+		cancel()
+
+		if errors.Is(err, redis.ErrClosed) {
+			return
+		}
+		up := err == nil
+		if avail.up.Swap(up) != up {
+			if up {
+				slog.Info("reconnected to redis, caching resumed")
+			} else {
+				slog.Warn("lost connection to redis, continuing without caching", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Redisに接続できない間、PING以外のコマンドをネットワークに出さずに失敗させるフック
+// ダウン中にリクエストごとに接続タイムアウトを待つのを防ぐ
+type availabilityHook struct {
+	up atomic.Bool
+}
+
+func (h *availabilityHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *availabilityHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !h.up.Load() && !strings.EqualFold(cmd.Name(), "ping") {
+			cmd.SetErr(ErrRedisUnavailable)
+			return ErrRedisUnavailable
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *availabilityHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !h.up.Load() {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrRedisUnavailable)
+			}
+			return ErrRedisUnavailable
+		}
+		return next(ctx, cmds)
+	}
+}
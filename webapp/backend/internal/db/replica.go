@@ -0,0 +1,159 @@
+package db
+
+import (
+	"backend/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 読み取り専用レプリカへの接続
+//
+// 定期的に死活とレプリケーション遅延を確認し、使えない間はHealthyがfalseを返す。
+// 呼び出し側はHealthyがfalseの間プライマリから読むこと。
+// 起動時にレプリカへ接続できなくてもエラーにはせず、バックグラウンドで確認を続ける
+type Replica struct {
+	*sqlx.DB
+
+	up     atomic.Bool
+	maxLag time.Duration
+	done   chan struct{}
+}
+
+// レプリカへの接続を初期化する
+// レプリカが設定されていない場合はnilを返す
+func InitReplicaConnection(cfg config.DatabaseConfig) (*Replica, error) {
+	if cfg.ReplicaURL == "" {
+		return nil, nil
+	}
+	dbConn, err := open(cfg.ReplicaURL, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replica connection: %w", err)
+	}
+	r := &Replica{DB: dbConn, maxLag: cfg.ReplicaMaxLag, done: make(chan struct{})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.check(ctx); err != nil {
+		slog.Warn("mysql replica unavailable, reading from primary until it recovers",
+			slog.Duration("check_interval", cfg.ReplicaCheckInterval), slog.Any("error", err))
+	} else {
+		r.up.Store(true)
+		slog.Info("connected to mysql replica")
+	}
+
+	go r.monitor(cfg.ReplicaCheckInterval)
+	return r, nil
+}
+
+// レプリカから読んでよいか
+func (r *Replica) Healthy() bool {
+	return r.up.Load()
+}
+
+// クエリが接続エラーで失敗したことを通知する
+// 次の定期確認で復旧するまでプライマリから読むようにする
+func (r *Replica) ReportError(err error) {
+	if r.up.Swap(false) {
+		slog.Warn("mysql replica query failed, reading from primary", slog.Any("error", err))
+	}
+}
+
+// 定期確認を止めて接続を閉じる
+func (r *Replica) Close() error {
+	close(r.done)
+	return r.DB.Close()
+}
+
+func (r *Replica) monitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := r.check(ctx)
+		cancel()
+
+		up := err == nil
+		if r.up.Swap(up) != up {
+			if up {
+				slog.Info("mysql replica recovered, routing reads to replica")
+			} else {
+				slog.Warn("mysql replica unhealthy, reading from primary", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// 接続できること、設定されていればレプリケーション遅延が許容範囲内であることを確認する
+func (r *Replica) check(ctx context.Context) error {
+	if err := r.PingContext(ctx); err != nil {
+		return err
+	}
+	if r.maxLag <= 0 {
+		return nil
+	}
+	lag, err := r.lag(ctx)
+	if err != nil {
+		return err
+	}
+	if lag > r.maxLag {
+		return fmt.Errorf("replication lag %s exceeds %s", lag, r.maxLag)
+	}
+	return nil
+}
+
+// SHOW REPLICA STATUSからレプリケーション遅延を取得する (REPLICATION CLIENT権限が必要)
+func (r *Replica) lag(ctx context.Context) (time.Duration, error) {
+	rows, err := r.QueryxContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("replication is not configured")
+	}
+	status := map[string]any{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+	// MySQL 8.0.22より前はSeconds_Behind_Master
+	for _, col := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		v, ok := status[col]
+		if !ok {
+			continue
+		}
+		// レプリケーションが停止している場合はNULL
+		if v == nil {
+			return 0, errors.New("replication is stopped")
+		}
+		var s string
+		switch v := v.(type) {
+		case []byte:
+			s = string(v)
+		default:
+			s = fmt.Sprint(v)
+		}
+		seconds, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected replication lag %q", s)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replication lag not reported")
+}
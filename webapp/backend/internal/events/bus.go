@@ -0,0 +1,290 @@
+// 注文ステータス変更のイベントバス
+//
+// RobotServiceが発行したイベントをRedisのPub/Subで全てのバックエンドに配り、
+// 各プロセスは自分に接続しているSSEクライアント(Subscription)に届ける。
+// 再接続時にLast-Event-ID以降のイベントを再送できるよう、ユーザーごとに直近のイベントを
+// Redisのソート済みセットに残しておく。
+//
+// Redisを使えない間は同じプロセスの購読者にのみ届ける。この場合はイベントIDが付かず、再送もできない
+package events
+
+import (
+	"backend/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// 全てのバックエンドが購読するPub/Subのチャンネル
+	channel = "order_events"
+	// イベントIDの採番に使うカウンター
+	seqKey = "order_events:seq"
+	// ユーザーごとの直近のイベント (スコアがイベントID)
+	historyKeyPrefix = "order_events:user:"
+	// ユーザーごとに再送用に残すイベント数と保持期間
+	historySize = 200
+	historyTTL  = 24 * time.Hour
+	// 購読者ごとのバッファ。あふれた購読者は打ち切り、再接続時の再送で追いつかせる
+	subscriptionBuffer = 64
+)
+
+// Closeした後に購読しようとした
+var ErrClosed = errors.New("event bus closed")
+
+// 1つのSSE接続に対応する購読
+type Subscription struct {
+	userID int
+	ch     chan model.OrderStatusEvent
+	// 受信が追いつかずに打ち切られた
+	lagged atomic.Bool
+}
+
+// イベントを受け取るチャンネル
+// 購読が終わると閉じられる (Laggedで打ち切りかどうかを判定できる)
+func (s *Subscription) Events() <-chan model.OrderStatusEvent {
+	return s.ch
+}
+
+// 受信が追いつかずに打ち切られたか
+func (s *Subscription) Lagged() bool {
+	return s.lagged.Load()
+}
+
+type Bus struct {
+	redis  redis.UniversalClient
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	subs   map[int]map[*Subscription]struct{}
+	count  int
+	closed bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// redisClientがnilの場合はプロセス内でのみ配信する
+func NewBus(redisClient redis.UniversalClient, logger *slog.Logger) *Bus {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bus{
+		redis:  redisClient,
+		logger: logger,
+		subs:   make(map[int]map[*Subscription]struct{}),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if redisClient != nil {
+		go b.listen(ctx)
+	} else {
+		close(b.done)
+	}
+	return b
+}
+
+// userIDの注文のイベントを購読する
+func (b *Bus) Subscribe(userID int) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	sub := &Subscription{userID: userID, ch: make(chan model.OrderStatusEvent, subscriptionBuffer)}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	b.count++
+	return sub, nil
+}
+
+// 購読をやめる (打ち切り済みの場合は何もしない)
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// b.muを保持した状態で呼ぶこと
+func (b *Bus) remove(sub *Subscription) {
+	subs, ok := b.subs[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subs, sub.userID)
+	}
+	b.count--
+	close(sub.ch)
+}
+
+// 購読者数
+func (b *Bus) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+// イベントにIDを振って全てのバックエンドに配信する
+//
+// Redisに書き込めなかった場合は同じプロセスの購読者にのみ配信し、エラーを返す。
+// 配信は通知のためのベストエフォートなので、呼び出し側は記録するだけでよい
+func (b *Bus) Publish(ctx context.Context, events []model.OrderStatusEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if b.redis == nil {
+		b.dispatch(events)
+		return nil
+	}
+
+	last, err := b.redis.IncrBy(ctx, seqKey, int64(len(events))).Result()
+	if err != nil {
+		b.dispatch(events)
+		return fmt.Errorf("events: assign ids: %w", err)
+	}
+	byUser := make(map[int][]redis.Z)
+	for i := range events {
+		events[i].ID = last - int64(len(events)) + int64(i) + 1
+		data, err := json.Marshal(events[i])
+		if err != nil {
+			return err
+		}
+		byUser[events[i].UserID] = append(byUser[events[i].UserID], redis.Z{Score: float64(events[i].ID), Member: data})
+	}
+	payload, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.redis.Pipeline()
+	for userID, members := range byUser {
+		key := historyKey(userID)
+		pipe.ZAdd(ctx, key, members...)
+		pipe.ZRemRangeByRank(ctx, key, 0, -historySize-1)
+		pipe.Expire(ctx, key, historyTTL)
+	}
+	pipe.Publish(ctx, channel, payload)
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Pub/Subで届いている場合もあるが、購読側でIDによる重複除去をする
+		b.dispatch(events)
+		return fmt.Errorf("events: publish: %w", err)
+	}
+	return nil
+}
+
+// afterIDより後のuserIDのイベントを古い順に返す
+// 保持期間・件数を超えて取りこぼしている可能性がある場合はcompleteがfalseになる
+func (b *Bus) Replay(ctx context.Context, userID int, afterID int64) (_ []model.OrderStatusEvent, complete bool, err error) {
+	if b.redis == nil {
+		return nil, false, nil
+	}
+	key := historyKey(userID)
+	pipe := b.redis.Pipeline()
+	rangeCmd := pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + strconv.FormatInt(afterID, 10), Max: "+inf"})
+	countCmd := pipe.ZCard(ctx, key)
+	oldestCmd := pipe.ZRangeWithScores(ctx, key, 0, 0)
+	seqCmd := pipe.Get(ctx, seqKey)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, fmt.Errorf("events: replay: %w", err)
+	}
+
+	events := make([]model.OrderStatusEvent, 0, len(rangeCmd.Val()))
+	for _, raw := range rangeCmd.Val() {
+		var ev model.OrderStatusEvent
+		if err := json.Unmarshal([]byte(raw), &ev); err != nil {
+			return nil, false, fmt.Errorf("events: decode history: %w", err)
+		}
+		events = append(events, ev)
+	}
+
+	complete = true
+	// 採番が巻き戻っている (Redisのデータが消えた)
+	if seq, err := seqCmd.Int64(); err != nil || afterID > seq {
+		complete = false
+	}
+	// 上限まで溜まっていて、残っている最古のイベントより前から再開しようとしている
+	if oldest := oldestCmd.Val(); countCmd.Val() >= historySize && len(oldest) > 0 && int64(oldest[0].Score) > afterID+1 {
+		complete = false
+	}
+	return events, complete, nil
+}
+
+// 購読を全て終了し、Redisの購読を止める
+// SSEのハンドラーが戻るよう、HTTPサーバーのシャットダウン開始時に呼ぶ
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+	b.mu.Unlock()
+
+	b.cancel()
+	<-b.done
+}
+
+// 同じプロセスの購読者にイベントを届ける
+func (b *Bus) dispatch(events []model.OrderStatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ev := range events {
+		for sub := range b.subs[ev.UserID] {
+			select {
+			case sub.ch <- ev:
+			default:
+				sub.lagged.Store(true)
+				b.remove(sub)
+				b.logger.Warn("dropping slow event subscriber", slog.Int("user_id", ev.UserID))
+			}
+		}
+	}
+}
+
+// Redisのチャンネルを購読し、届いたイベントをこのプロセスの購読者に配る
+// 接続が切れた場合はgo-redisが再接続する
+func (b *Bus) listen(ctx context.Context) {
+	defer close(b.done)
+	pubsub := b.redis.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var events []model.OrderStatusEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &events); err != nil {
+				b.logger.Warn("invalid order event payload", slog.Any("error", err))
+				continue
+			}
+			b.dispatch(events)
+		}
+	}
+}
+
+func historyKey(userID int) string {
+	return historyKeyPrefix + strconv.Itoa(userID)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type APITokenHandler struct {
+	TokenSvc *service.APITokenService
+	Logger   *slog.Logger
+}
+
+func NewAPITokenHandler(svc *service.APITokenService, logger *slog.Logger) *APITokenHandler {
+	return &APITokenHandler{TokenSvc: svc, Logger: logger}
+}
+
+// APIトークンを発行
+// レスポンスのtokenは再取得できないため、クライアント側で保存してもらう
+func (h *APITokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	var req model.CreateAPITokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	resp, err := h.TokenSvc.Create(r.Context(), userID, req)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "create api token failed", err, slog.Int("user_id", userID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// APIトークン一覧を取得
+func (h *APITokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	tokens, err := h.TokenSvc.List(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "list api tokens failed", err, slog.Int("user_id", userID))
+		return
+	}
+
+	resp := struct {
+		Data []model.APIToken `json:"data"`
+	}{
+		Data: tokens,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// APIトークンを失効
+func (h *APITokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		writeInvalidParameter(w, r, "tokenID", "must be an integer")
+		return
+	}
+
+	if err := h.TokenSvc.Revoke(r.Context(), userID, tokenID); err != nil {
+		writeServiceError(w, r, h.Logger, "revoke api token failed", err,
+			slog.Int("user_id", userID), slog.Int64("token_id", tokenID))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,38 +3,53 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 
+	"backend/internal/apierror"
+	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
 )
 
+// セッションCookieとCSRFトークンCookieに付与する属性
+type CookieConfig struct {
+	Secure   bool
+	SameSite http.SameSite
+}
+
 type AuthHandler struct {
 	AuthSvc *service.AuthService
+	Cookie  CookieConfig
+	Logger  *slog.Logger
 }
 
-func NewAuthHandler(authSvc *service.AuthService) *AuthHandler {
-	return &AuthHandler{AuthSvc: authSvc}
+func NewAuthHandler(authSvc *service.AuthService, cookieCfg CookieConfig, logger *slog.Logger) *AuthHandler {
+	return &AuthHandler{AuthSvc: authSvc, Cookie: cookieCfg, Logger: logger}
 }
 
 // ログイン時にセッションを発行し、Cookieにセットする
+// あわせてダブルサブミット用のCSRFトークンを発行する
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	log.Println("-> Received request for /api/login")
-
 	var req model.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	sessionID, expiresAt, err := h.AuthSvc.Login(r.Context(), req.UserName, req.Password)
 	if err != nil {
+		// ユーザーの存在を推測されないよう、どちらも同じエラーにする
 		if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrInvalidPassword) {
-			http.Error(w, "Unauthorized: Invalid credentials", http.StatusUnauthorized)
-		} else {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidCredentials)
+			return
 		}
+		writeServiceError(w, r, h.Logger, "login failed", err)
+		return
+	}
+
+	csrfToken, err := middleware.NewCSRFToken()
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "csrf token generation failed", err)
 		return
 	}
 
@@ -43,10 +58,21 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Value:    sessionID,
 		Expires:  expiresAt,
 		HttpOnly: true,
+		Secure:   h.Cookie.Secure,
+		SameSite: h.Cookie.SameSite,
+		Path:     "/",
+	})
+	// フロントエンドのJSから読み取ってヘッダーに付与するためHttpOnlyにはしない
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookieName,
+		Value:    csrfToken,
+		Expires:  expiresAt,
+		Secure:   h.Cookie.Secure,
+		SameSite: h.Cookie.SameSite,
 		Path:     "/",
 	})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful", "csrf_token": csrfToken})
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/model"
+	"backend/internal/service"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// サービスのエラーとエラーレスポンスの対応
+// ハンドラーごとに意味が変わるエラー(ログイン時のErrUserNotFoundなど)は各ハンドラーで先に扱う
+var serviceErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrUserNotFound, http.StatusNotFound, apierror.CodeUserNotFound},
+	{service.ErrInvalidPassword, http.StatusUnauthorized, apierror.CodeInvalidCredentials},
+	{service.ErrUserAlreadyExists, http.StatusConflict, apierror.CodeUserAlreadyExists},
+	{service.ErrInvalidUserInput, http.StatusBadRequest, apierror.CodeValidationFailed},
+	{service.ErrTokenNotFound, http.StatusNotFound, apierror.CodeAPITokenNotFound},
+	{service.ErrInvalidTokenInput, http.StatusBadRequest, apierror.CodeValidationFailed},
+	{service.ErrInvalidCursor, http.StatusBadRequest, apierror.CodeInvalidCursor},
+	{service.ErrTooManyExports, http.StatusTooManyRequests, apierror.CodeTooManyExports},
+	{service.ErrEventsUnavailable, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable},
+	{service.ErrWebhookNotFound, http.StatusNotFound, apierror.CodeWebhookNotFound},
+	{service.ErrInvalidWebhookInput, http.StatusBadRequest, apierror.CodeValidationFailed},
+	{service.ErrDeliveryNotRedeliverable, http.StatusConflict, apierror.CodeDeliveryNotRedeliverable},
+	{service.ErrOrderNotFound, http.StatusNotFound, apierror.CodeOrderNotFound},
+	{service.ErrInvalidStatsWindow, http.StatusBadRequest, apierror.CodeValidationFailed},
+}
+
+// サービスのエラーをエラーレスポンスにする
+// 対応するエラーがない場合はlogMsgでログに記録し、タイムアウトなら504、それ以外は500を返す
+func writeServiceError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, logMsg string, err error, attrs ...slog.Attr) {
+	for _, e := range serviceErrors {
+		if !errors.Is(err, e.err) {
+			continue
+		}
+		// 入力の検証エラーであれば、違反したフィールドを詳細として返す
+		var details []model.FieldError
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			details = validationErr.Details
+		}
+		apierror.Write(w, r, e.status, e.code, details...)
+		return
+	}
+
+	attrs = append(attrs, slog.Any("error", err))
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.LogAttrs(r.Context(), slog.LevelWarn, logMsg, attrs...)
+		apierror.Write(w, r, http.StatusGatewayTimeout, apierror.CodeTimeout)
+		return
+	}
+	logger.LogAttrs(r.Context(), slog.LevelError, logMsg, attrs...)
+	apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal)
+}
+
+// 認証ミドルウェアを通っているのにユーザーが取得できない場合 (ルーティングの設定ミス)
+func writeMissingUser(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal)
+}
+
+// URLのパスパラメータ・クエリパラメータが不正
+func writeInvalidParameter(w http.ResponseWriter, r *http.Request, name, reason string) {
+	apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidParameter, model.FieldError{Field: name, Reason: reason})
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"net/http"
+)
+
+type HealthHandler struct {
+	HealthSvc *service.HealthService
+	// シャットダウン中はfalseを返す
+	IsReady func() bool
+}
+
+func NewHealthHandler(svc *service.HealthService, ready func() bool) *HealthHandler {
+	return &HealthHandler{HealthSvc: svc, IsReady: ready}
+}
+
+// プロセスが生きていれば常に200を返す (依存先はチェックしない)
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": model.HealthStatusOK})
+}
+
+// 依存先の状態を確認し、リクエストを受け付けられるかを返す
+// MySQLに接続できない場合とシャットダウン中は503、Redisのみ不調な場合は200でdegradedを返す
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.HealthSvc.Check(r.Context())
+
+	code := http.StatusOK
+	if !h.IsReady() {
+		report.Status = model.HealthStatusUnavailable
+		report.Checks["server"] = model.HealthCheck{Status: model.HealthStatusUnavailable, Error: "shutting down"}
+	}
+	if report.Status == model.HealthStatusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
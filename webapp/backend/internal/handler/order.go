@@ -5,33 +5,21 @@ import (
 	"backend/internal/model"
 	"backend/internal/service"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 type OrderHandler struct {
 	OrderSvc *service.OrderService
+	Logger   *slog.Logger
 }
 
-func NewOrderHandler(svc *service.OrderService) *OrderHandler {
-	return &OrderHandler{OrderSvc: svc}
+func NewOrderHandler(svc *service.OrderService, logger *slog.Logger) *OrderHandler {
+	return &OrderHandler{OrderSvc: svc, Logger: logger}
 }
 
-// 注文履歴一覧を取得
-func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserFromContext(r.Context())
-	if !ok {
-		http.Error(w, "User not found", http.StatusInternalServerError)
-		return
-	}
-
-	var req model.ListRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// デフォルト値の設定
+// 一覧取得・エクスポート共通のデフォルト値を設定する
+func setOrderListDefaults(req *model.OrderListRequest) {
 	if req.Page <= 0 {
 		req.Page = 1
 	}
@@ -47,20 +35,36 @@ func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
 	if req.Type != "" && req.Type != "partial" && req.Type != "prefix" {
 		req.Type = "partial"
 	}
+	req.Offset = (req.Page - 1) * req.PageSize
+}
+
+// 注文履歴一覧を取得
+func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	var req model.OrderListRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	setOrderListDefaults(&req)
 
-	orders, total, err := h.OrderSvc.FetchOrders(r.Context(), userID, req)
+	orders, page, err := h.OrderSvc.FetchOrders(r.Context(), userID, req)
 	if err != nil {
-		log.Printf("Failed to fetch orders for user %d: %v", userID, err)
-		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "fetch orders failed", err, slog.Int("user_id", userID))
 		return
 	}
 
 	resp := struct {
-		Data  []model.Order `json:"data"`
-		Total int           `json:"total"`
+		Data []model.Order `json:"data"`
+		model.PageInfo
 	}{
-		Data:  orders,
-		Total: total,
+		Data:     orders,
+		PageInfo: page,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
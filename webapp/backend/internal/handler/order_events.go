@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// プロキシやロードバランサーにアイドル接続として切られないよう、コメント行を送る間隔
+	sseHeartbeatInterval = 15 * time.Second
+	// 切断されたEventSourceが再接続するまでの待ち時間 (ミリ秒)
+	sseRetryMillis = 3000
+)
+
+// 注文ステータスの変更をServer-Sent Eventsで配信する
+//
+// イベント:
+//   - order_status: 注文のステータスが変わった (dataはmodel.OrderStatusEvent)
+//   - resync: Last-Event-ID以降のイベントを取りこぼした可能性がある。注文履歴を取得し直すこと
+//
+// 再接続時はEventSourceが送るLast-Event-IDヘッダー(またはlast_event_idクエリ)以降のイベントを再送する
+func (h *OrderHandler) Events(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			writeInvalidParameter(w, r, "Last-Event-ID", "must be a non-negative integer")
+			return
+		}
+		lastID = id
+	}
+
+	// シャットダウン中はErrEventsUnavailableとして503になる
+	stream, err := h.OrderSvc.SubscribeStatusEvents(r.Context(), userID, lastID)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "subscribe order events failed", err, slog.Int("user_id", userID))
+		return
+	}
+	defer h.OrderSvc.CloseStatusEvents(stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginxがレスポンスをバッファリングしないようにする
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sse := &sseWriter{w: w, rc: http.NewResponseController(w)}
+	sse.printf("retry: %d\n\n", sseRetryMillis)
+	if stream.Incomplete {
+		sse.printf("event: resync\ndata: {}\n\n")
+	}
+	for _, ev := range stream.Backlog {
+		sse.event(ev)
+		lastID = max(lastID, ev.ID)
+	}
+	if err := sse.flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-stream.Events():
+			if !ok {
+				// サーバーの停止、または受信が追いつかずに打ち切られた
+				// クライアントはLast-Event-IDを付けて再接続し、続きを受け取る
+				return
+			}
+			// 再送済みのイベントや、Redisの障害時に重複して届いたイベントを除く
+			if ev.ID != 0 && ev.ID <= lastID {
+				continue
+			}
+			sse.event(ev)
+			lastID = max(lastID, ev.ID)
+		case <-heartbeat.C:
+			sse.printf(": ping\n\n")
+		}
+		if err := sse.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// SSEの書き出し
+// 最初の書き込みエラーを保持し、以降の書き込みは行わない
+type sseWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	err error
+}
+
+func (s *sseWriter) printf(format string, args ...any) {
+	if s.err != nil {
+		return
+	}
+	// サーバー全体のWriteTimeoutで切られないよう、書き込むたびに期限を延長する
+	_ = s.rc.SetWriteDeadline(time.Now().Add(2 * sseHeartbeatInterval))
+	_, s.err = fmt.Fprintf(s.w, format, args...)
+}
+
+func (s *sseWriter) event(ev model.OrderStatusEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		s.err = err
+		return
+	}
+	// Redisに接続できない間のイベントにはIDがなく、再送もできない
+	if ev.ID != 0 {
+		s.printf("id: %d\n", ev.ID)
+	}
+	s.printf("event: order_status\ndata: %s\n\n", data)
+}
+
+func (s *sseWriter) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		s.err = err
+	}
+	return s.err
+}
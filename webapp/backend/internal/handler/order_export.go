@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// エクスポートの出力形式
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+)
+
+// クライアントの受信が止まった場合に接続を切るまでの時間
+// サーバー全体のWriteTimeoutでは大量の行を書き出しきれないため、バッチを書き出すごとに延長する
+const exportWriteTimeout = 60 * time.Second
+
+// CSVの日時の書式 (Excelで日時として認識される形式)
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// ExcelがUTF-8として開くためのBOM
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+var orderCSVHeader = []string{"order_id", "product_id", "product_name", "shipped_status", "created_at", "arrived_at"}
+
+// 注文履歴をCSV(?format=csv)またはJSON Lines(?format=ndjson)で書き出す
+// 絞り込み条件は注文履歴一覧と同じリクエストボディで指定する (ページングの指定は無視する)
+func (h *OrderHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		writeInvalidParameter(w, r, "format", "must be csv or ndjson")
+		return
+	}
+
+	// 全件を書き出す場合はボディを省略できる
+	var req model.OrderListRequest
+	if !decodeOptionalJSON(w, r, &req) {
+		return
+	}
+	setOrderListDefaults(&req)
+
+	out := newOrderExportWriter(w, format)
+	rc := http.NewResponseController(w)
+	err := h.OrderSvc.ExportOrders(r.Context(), userID, req, func(orders []model.Order) error {
+		out.start()
+		// ResponseControllerに対応していないResponseWriterの場合はサーバーの設定のまま書き出す
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err := out.write(orders); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil && !out.started {
+		writeServiceError(w, r, h.Logger, "export orders failed", err, slog.Int("user_id", userID))
+		return
+	}
+	if err != nil {
+		// ステータスコードは送信済みのため、接続を切って途中までのファイルを完了扱いにさせない
+		h.Logger.ErrorContext(r.Context(), "export orders aborted", slog.Int("user_id", userID), slog.Any("error", err))
+		panic(http.ErrAbortHandler)
+	}
+
+	// 0件の場合もヘッダー行だけのファイルを返す
+	out.start()
+	if err := out.flush(); err != nil {
+		h.Logger.WarnContext(r.Context(), "export orders flush failed", slog.Int("user_id", userID), slog.Any("error", err))
+	}
+}
+
+// 注文を1行ずつ書き出す
+type orderExportWriter struct {
+	w       http.ResponseWriter
+	format  string
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+}
+
+func newOrderExportWriter(w http.ResponseWriter, format string) *orderExportWriter {
+	return &orderExportWriter{w: w, format: format}
+}
+
+// レスポンスヘッダーと、CSVの場合はBOM・見出し行を書き出す (2回目以降は何もしない)
+func (o *orderExportWriter) start() {
+	if o.started {
+		return
+	}
+	o.started = true
+
+	filename := "orders-" + time.Now().Format("20060102-150405") + "." + o.format
+	if o.format == exportFormatCSV {
+		o.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		o.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	o.w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	o.w.Header().Set("Cache-Control", "no-store")
+	o.w.WriteHeader(http.StatusOK)
+
+	if o.format == exportFormatCSV {
+		_, _ = o.w.Write(utf8BOM)
+		o.csv = csv.NewWriter(o.w)
+		o.csv.UseCRLF = true
+		_ = o.csv.Write(orderCSVHeader)
+	} else {
+		o.json = json.NewEncoder(o.w)
+	}
+}
+
+func (o *orderExportWriter) write(orders []model.Order) error {
+	for _, order := range orders {
+		if o.format == exportFormatNDJSON {
+			// 注文履歴一覧のdataの要素と同じ形式
+			if err := o.json.Encode(order); err != nil {
+				return err
+			}
+			continue
+		}
+		arrivedAt := ""
+		if order.ArrivedAt.Valid {
+			arrivedAt = order.ArrivedAt.Time.Format(exportTimeLayout)
+		}
+		if err := o.csv.Write([]string{
+			strconv.FormatInt(order.OrderID, 10),
+			strconv.Itoa(order.ProductID),
+			csvSafe(order.ProductName),
+			order.ShippedStatus,
+			order.CreatedAt.Format(exportTimeLayout),
+			arrivedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return o.flush()
+}
+
+func (o *orderExportWriter) flush() error {
+	if o.csv == nil {
+		return nil
+	}
+	o.csv.Flush()
+	return o.csv.Error()
+}
+
+// 表計算ソフトで数式として解釈される先頭文字をエスケープする (CSVインジェクション対策)
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
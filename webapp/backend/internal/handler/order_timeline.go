@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// 注文のステータス変更の履歴を古い順に取得
+func (h *OrderHandler) Timeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "orderID"), 10, 64)
+	if err != nil {
+		writeInvalidParameter(w, r, "orderID", "must be an integer")
+		return
+	}
+
+	timeline, err := h.OrderSvc.GetTimeline(r.Context(), userID, orderID)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "get order timeline failed", err,
+			slog.Int("user_id", userID), slog.Int64("order_id", orderID))
+		return
+	}
+
+	resp := struct {
+		Data []model.OrderEvent `json:"data"`
+	}{
+		Data: timeline,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -1,12 +1,13 @@
 package handler
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,23 +17,25 @@ import (
 
 type ProductHandler struct {
 	ProductSvc *service.ProductService
+	// 商品画像の配置ディレクトリ
+	ImageDir string
+	Logger   *slog.Logger
 }
 
-func NewProductHandler(svc *service.ProductService) *ProductHandler {
-	return &ProductHandler{ProductSvc: svc}
+func NewProductHandler(svc *service.ProductService, imageDir string, logger *slog.Logger) *ProductHandler {
+	return &ProductHandler{ProductSvc: svc, ImageDir: imageDir, Logger: logger}
 }
 
 // 商品一覧を取得
 func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		writeMissingUser(w, r)
 		return
 	}
 
 	var req model.ListRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -50,19 +53,18 @@ func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 	req.Offset = (req.Page - 1) * req.PageSize
 
-	products, total, err := h.ProductSvc.FetchProducts(r.Context(), userID, req)
+	products, page, err := h.ProductSvc.FetchProducts(r.Context(), userID, req)
 	if err != nil {
-		log.Printf("Failed to fetch products for user %d: %v", userID, err)
-		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "fetch products failed", err, slog.Int("user_id", userID))
 		return
 	}
 
 	resp := struct {
-		Data  []model.Product `json:"data"`
-		Total int             `json:"total"`
+		Data []model.Product `json:"data"`
+		model.PageInfo
 	}{
-		Data:  products,
-		Total: total,
+		Data:     products,
+		PageInfo: page,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -73,20 +75,18 @@ func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User not found in context", http.StatusInternalServerError)
+		writeMissingUser(w, r)
 		return
 	}
 
 	var req model.CreateOrderRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	insertedOrderIDs, err := h.ProductSvc.CreateOrders(r.Context(), userID, req.Items)
 	if err != nil {
-		log.Printf("Failed to create orders: %v", err)
-		http.Error(w, "Failed to process order request", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "create orders failed", err, slog.Int("user_id", userID))
 		return
 	}
 
@@ -102,26 +102,25 @@ func (h *ProductHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) GetImage(w http.ResponseWriter, r *http.Request) {
 	imagePath := r.URL.Query().Get("path")
 	if imagePath == "" {
-		http.Error(w, "画像パスが指定されていません", http.StatusBadRequest)
+		writeInvalidParameter(w, r, "path", "is required")
 		return
 	}
 
 	imagePath = filepath.Clean(imagePath)
 	if filepath.IsAbs(imagePath) || strings.Contains(imagePath, "..") {
-		http.Error(w, "無効なパスです", http.StatusBadRequest)
+		writeInvalidParameter(w, r, "path", "must be a relative path inside the image directory")
 		return
 	}
 
-	baseImageDir := "/app/images"
-	fullPath := filepath.Join(baseImageDir, imagePath)
+	fullPath := filepath.Join(h.ImageDir, imagePath)
 
 	fileInfo, err := os.Stat(fullPath)
 	if os.IsNotExist(err) {
-		http.Error(w, "画像が見つかりません", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeImageNotFound)
 		return
 	}
 	if err != nil {
-		http.Error(w, "ファイル情報の取得に失敗しました", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "stat image failed", err, slog.String("path", imagePath))
 		return
 	}
 
@@ -167,7 +166,7 @@ func (h *ProductHandler) GetImage(w http.ResponseWriter, r *http.Request) {
 	// ストリーミング配信（メモリ効率的）
 	file, err := os.Open(fullPath)
 	if err != nil {
-		http.Error(w, "画像の読み込みに失敗しました", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "open image failed", err, slog.String("path", imagePath))
 		return
 	}
 	defer file.Close()
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// リクエストボディの上限 (バイト)
+// 最大の注文作成リクエスト(100商品)でも数KBのため、余裕を持たせている
+const maxRequestBodyBytes = 1 << 20
+
+// JSONのリクエストボディをdstに読み込んで検証する
+//
+// 上限を超えるボディ、未知のフィールド、JSONの後に続くデータは拒否する。
+// dstがmodel.Validatorを実装している場合はデコード後に検証する。
+// 失敗した場合はエラーレスポンスを書き込んでfalseを返す
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decodeBody(w, r, dst, false)
+}
+
+// decodeJSONと同じだが、空のボディを許可する (dstはゼロ値のまま検証する)
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decodeBody(w, r, dst, true)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any, allowEmpty bool) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil && !(allowEmpty && errors.Is(err, io.EOF)) {
+		writeDecodeError(w, r, err)
+		return false
+	}
+	// {"a":1}{"b":2} のように複数の値が続くボディは拒否する
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeDecodeError(w, r, err)
+			return false
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON,
+			model.FieldError{Reason: "body must contain a single JSON value"})
+		return false
+	}
+
+	if v, ok := dst.(model.Validator); ok {
+		if details := v.Validate(); len(details) > 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeValidationFailed, details...)
+			return false
+		}
+	}
+	return true
+}
+
+// デコードのエラーをクライアント向けのエラーレスポンスにする
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		maxBytesErr *http.MaxBytesError
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge,
+			model.FieldError{Reason: fmt.Sprintf("body must not exceed %d bytes", maxBytesErr.Limit)})
+	case errors.Is(err, io.EOF):
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, model.FieldError{Reason: "body is empty"})
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, model.FieldError{Reason: "body is truncated"})
+	case errors.As(err, &syntaxErr):
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON,
+			model.FieldError{Reason: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)})
+	case errors.As(err, &typeErr):
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeValidationFailed,
+			model.FieldError{Field: jsonFieldPath(typeErr.Field), Reason: "must be " + jsonTypeName(typeErr.Type.String())})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/jsonは未知のフィールドを専用の型で返さない
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeUnknownField, model.FieldError{Field: field, Reason: "unknown field"})
+	default:
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON)
+	}
+}
+
+// encoding/jsonのフィールドのパス (items.0.quantity) をFieldErrorの形式 (items[0].quantity) にする
+func jsonFieldPath(path string) string {
+	parts := strings.Split(path, ".")
+	var b strings.Builder
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil && i > 0 {
+			b.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// Goの型名をJSONの型名にする
+func jsonTypeName(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"), strings.HasPrefix(goType, "float"):
+		return "a number"
+	case goType == "string":
+		return "a string"
+	case goType == "bool":
+		return "a boolean"
+	case strings.HasPrefix(goType, "[]"):
+		return "an array"
+	}
+	return "an object"
+}
@@ -4,38 +4,43 @@ import (
 	"backend/internal/model"
 	"backend/internal/service"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 )
 
+// 配送ロボットのID
+// ロボットの認証はAPIキーのみで個体を区別しないため、固定値を使う
+const defaultRobotID = "robot-001"
+
 type RobotHandler struct {
 	RobotSvc *service.RobotService
+	Logger   *slog.Logger
 }
 
-func NewRobotHandler(robotSvc *service.RobotService) *RobotHandler {
-	return &RobotHandler{RobotSvc: robotSvc}
+func NewRobotHandler(robotSvc *service.RobotService, logger *slog.Logger) *RobotHandler {
+	return &RobotHandler{RobotSvc: robotSvc, Logger: logger}
 }
 
 // 配送計画を取得
 func (h *RobotHandler) GetDeliveryPlan(w http.ResponseWriter, r *http.Request) {
-	robotID := "robot-001"
+	robotID := defaultRobotID
 
 	capacityStr := r.URL.Query().Get("capacity")
 	if capacityStr == "" {
-		http.Error(w, "Query parameter 'capacity' is required", http.StatusBadRequest)
+		writeInvalidParameter(w, r, "capacity", "is required")
 		return
 	}
 	capacity, err := strconv.Atoi(capacityStr)
 	if err != nil {
-		http.Error(w, "Query parameter 'capacity' must be an integer", http.StatusBadRequest)
+		writeInvalidParameter(w, r, "capacity", "must be an integer")
 		return
 	}
 
 	plan, err := h.RobotSvc.GenerateDeliveryPlan(r.Context(), robotID, capacity)
 	if err != nil {
-		log.Printf("Failed to generate delivery plan: %v", err)
-		http.Error(w, "Failed to create delivery plan", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "generate delivery plan failed", err,
+			slog.String("robot_id", robotID), slog.Int("capacity", capacity))
 		return
 	}
 
@@ -46,15 +51,14 @@ func (h *RobotHandler) GetDeliveryPlan(w http.ResponseWriter, r *http.Request) {
 // 配送完了時に注文ステータスを更新
 func (h *RobotHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	var req model.UpdateOrderStatusRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	err := h.RobotSvc.UpdateOrderStatus(r.Context(), req.OrderID, req.NewStatus)
+	err := h.RobotSvc.UpdateOrderStatus(r.Context(), defaultRobotID, req.OrderID, req.NewStatus)
 	if err != nil {
-		log.Printf("Failed to update order status for order %d: %v", req.OrderID, err)
-		http.Error(w, "Failed to update order status", http.StatusInternalServerError)
+		writeServiceError(w, r, h.Logger, "update order status failed", err,
+			slog.Int64("order_id", req.OrderID), slog.String("new_status", req.NewStatus))
 		return
 	}
 
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type StatsHandler struct {
+	StatsSvc *service.StatsService
+	Logger   *slog.Logger
+}
+
+func NewStatsHandler(svc *service.StatsService, logger *slog.Logger) *StatsHandler {
+	return &StatsHandler{StatsSvc: svc, Logger: logger}
+}
+
+// 配送統計を取得
+// 全ユーザーの注文が対象のため、ルートで管理者とオペレーターに制限している
+// from・toはRFC3339形式 (省略時は直近7日間)
+func (h *StatsHandler) Delivery(w http.ResponseWriter, r *http.Request) {
+	var from, to *time.Time
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"from", &from},
+		{"to", &to},
+	} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeInvalidParameter(w, r, p.name, "must be an RFC3339 timestamp")
+			return
+		}
+		*p.dst = &t
+	}
+
+	stats, err := h.StatsSvc.DeliveryStats(r.Context(), from, to)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "get delivery stats failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
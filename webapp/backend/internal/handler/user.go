@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+type UserHandler struct {
+	UserSvc *service.UserService
+	Logger  *slog.Logger
+}
+
+func NewUserHandler(userSvc *service.UserService, logger *slog.Logger) *UserHandler {
+	return &UserHandler{UserSvc: userSvc, Logger: logger}
+}
+
+// 管理者がユーザーを作成する
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateUserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.UserSvc.CreateUser(r.Context(), req)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "create user failed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// ログイン中のユーザーが自身のパスワードを変更する
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+	sessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+	var req model.ChangePasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	err := h.UserSvc.ChangePassword(r.Context(), userID, sessionID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		// 現在のパスワードの誤りはErrInvalidPasswordとして401になる
+		writeServiceError(w, r, h.Logger, "change password failed", err, slog.Int("user_id", userID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"})
+}
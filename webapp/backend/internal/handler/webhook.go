@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	WebhookSvc *service.WebhookService
+	Logger     *slog.Logger
+}
+
+func NewWebhookHandler(svc *service.WebhookService, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{WebhookSvc: svc, Logger: logger}
+}
+
+// Webhookを登録
+// レスポンスのsecretは再取得できないため、クライアント側で保存してもらう
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	var req model.CreateWebhookRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	resp, err := h.WebhookSvc.Create(r.Context(), userID, req)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "create webhook failed", err, slog.Int("user_id", userID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Webhook一覧を取得
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	webhooks, err := h.WebhookSvc.List(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "list webhooks failed", err, slog.Int("user_id", userID))
+		return
+	}
+
+	resp := struct {
+		Data []model.Webhook `json:"data"`
+	}{
+		Data: webhooks,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Webhookを削除
+// 未送信のイベントと送信履歴も削除される
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		writeInvalidParameter(w, r, "webhookID", "must be an integer")
+		return
+	}
+
+	if err := h.WebhookSvc.Delete(r.Context(), userID, webhookID); err != nil {
+		writeServiceError(w, r, h.Logger, "delete webhook failed", err,
+			slog.Int("user_id", userID), slog.Int64("webhook_id", webhookID))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Webhookの送信履歴を新しい順に取得
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		writeInvalidParameter(w, r, "webhookID", "must be an integer")
+		return
+	}
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			writeInvalidParameter(w, r, "limit", "must be a positive integer")
+			return
+		}
+	}
+
+	deliveries, err := h.WebhookSvc.ListDeliveries(r.Context(), userID, webhookID, limit)
+	if err != nil {
+		writeServiceError(w, r, h.Logger, "list webhook deliveries failed", err,
+			slog.Int("user_id", userID), slog.Int64("webhook_id", webhookID))
+		return
+	}
+
+	resp := struct {
+		Data []model.WebhookDelivery `json:"data"`
+	}{
+		Data: deliveries,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// 再試行の上限に達した(dead)送信を再送する
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		writeMissingUser(w, r)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		writeInvalidParameter(w, r, "webhookID", "must be an integer")
+		return
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		writeInvalidParameter(w, r, "deliveryID", "must be an integer")
+		return
+	}
+
+	if err := h.WebhookSvc.Redeliver(r.Context(), userID, webhookID, deliveryID); err != nil {
+		writeServiceError(w, r, h.Logger, "redeliver webhook failed", err,
+			slog.Int("user_id", userID), slog.Int64("delivery_id", deliveryID))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
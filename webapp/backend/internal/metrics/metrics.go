@@ -0,0 +1,213 @@
+// Prometheus向けのメトリクス定義
+//
+// メトリクスはパッケージ独自のRegistryに登録し、Handlerで/metricsとして公開する。
+// ラベルのカーディナリティが爆発しないよう、ルートにはchiのルートパターンを使い、
+// ユーザーIDや検索語などの値はラベルにしないこと。
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "backend"
+
+// キャッシュ名 (cacheラベルの値)
+const (
+	CacheSession = "session"
+	CacheProduct = "product"
+	CacheStats   = "stats"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_cache_requests_total",
+		Help:      "Redis cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	knapsackDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "knapsack_solve_duration_seconds",
+		Help:      "Time spent solving the delivery plan knapsack.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	})
+
+	knapsackItems = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "knapsack_problem_items",
+		Help:      "Number of candidate orders passed to the knapsack solver.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+
+	knapsackCapacity = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "knapsack_problem_capacity",
+		Help:      "Robot capacity passed to the knapsack solver.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result (succeeded, retry or dead).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		cacheRequests,
+		knapsackDuration,
+		knapsackItems,
+		knapsackCapacity,
+		webhookDeliveries,
+	)
+}
+
+// /metricsのハンドラー
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// HTTPリクエスト1件分を記録する
+func ObserveHTTPRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// キャッシュヒットを記録する
+func CacheHit(cache string) {
+	cacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+// キャッシュミスを記録する (Redisに接続できない場合も含む)
+func CacheMiss(cache string) {
+	cacheRequests.WithLabelValues(cache, "miss").Inc()
+}
+
+// ナップサック問題の規模と解くのにかかった時間を記録する
+func ObserveKnapsack(items, capacity int, elapsed time.Duration) {
+	knapsackItems.Observe(float64(items))
+	knapsackCapacity.Observe(float64(capacity))
+	knapsackDuration.Observe(elapsed.Seconds())
+}
+
+// Webhookの送信1回分の結果を記録する
+func WebhookDelivery(result string) {
+	webhookDeliveries.WithLabelValues(result).Inc()
+}
+
+// コネクションプールの統計 (sql.DB.Stats) を公開する
+func RegisterDBStats(db *sql.DB, dbName string) {
+	replace(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// CachingProductRepositoryのエントリ数を公開する
+func RegisterProductCacheSize(size func() int) {
+	replace(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "product_cache_entries",
+		Help:      "Number of entries held by the in-process product cache.",
+	}, func() float64 { return float64(size()) }))
+}
+
+// 注文ステータスの変更通知(SSE)の購読者数を公開する
+func RegisterEventSubscribers(count func() int) {
+	replace(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "order_event_subscribers",
+		Help:      "Number of open order status event streams on this process.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// ステータスごとの注文数を公開する
+// スクレイプのたびに集計クエリを流さないよう、結果をttlの間使い回す
+func RegisterOrderStatusCounts(count func(ctx context.Context) (map[string]int, error), ttl time.Duration) {
+	replace(&orderStatusCollector{
+		count: count,
+		ttl:   ttl,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "orders"),
+			"Number of orders by shipped status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+type orderStatusCollector struct {
+	count func(ctx context.Context) (map[string]int, error)
+	ttl   time.Duration
+	desc  *prometheus.Desc
+
+	mu        sync.Mutex
+	cached    map[string]int
+	fetchedAt time.Time
+}
+
+func (c *orderStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *orderStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached == nil || time.Since(c.fetchedAt) >= c.ttl {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		counts, err := c.count(ctx)
+		cancel()
+		if err != nil {
+			// 取得に失敗した場合は直前の値を出し続ける
+			slog.Warn("failed to count orders by status", slog.Any("error", err))
+		} else {
+			c.cached = counts
+			c.fetchedAt = time.Now()
+		}
+	}
+
+	for status, n := range c.cached {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+// コレクターを登録する
+// サーバーを作り直した場合(NewServerを複数回呼んだ場合)は古いコレクターと差し替える
+func replace(c prometheus.Collector) {
+	if err := Registry.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			panic(err)
+		}
+		Registry.Unregister(are.ExistingCollector)
+		Registry.MustRegister(c)
+	}
+}
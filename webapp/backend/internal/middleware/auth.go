@@ -2,65 +2,113 @@ package middleware
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"backend/internal/apierror"
+	"backend/internal/logging"
+	"backend/internal/metrics"
+	"backend/internal/model"
 	"backend/internal/repository"
+	"backend/internal/service/utils"
+	"backend/internal/telemetry"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey       contextKey = "user"
+	roleContextKey       contextKey = "role"
+	sessionIDContextKey  contextKey = "session_id"
+	authMethodContextKey contextKey = "auth_method"
+	scopesContextKey     contextKey = "scopes"
+)
+
+// リクエストの認証方式
+const (
+	AuthMethodSession = "session"
+	AuthMethodToken   = "token"
+)
 
-func UserAuthMiddleware(sessionRepo *repository.SessionRepository, redisClient *redis.Client) func(http.Handler) http.Handler {
+// セッションCookieまたはAuthorization: Bearerのトークンでユーザーを認証する
+// どちらの場合もGetUserFromContextで同じようにユーザーIDを取得できる
+func UserAuthMiddleware(sessionRepo *repository.SessionRepository, tokenRepo *repository.APITokenRepository, redisClient redis.UniversalClient, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 0. Bearerトークンが指定されていればAPIトークンとして認証する
+			if token, ok := bearerToken(r); ok {
+				ctx := r.Context()
+				owner, err := tokenRepo.FindActiveByHash(ctx, utils.HashAPIToken(token))
+				if err != nil {
+					apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidAPIToken)
+					return
+				}
+				if err := tokenRepo.TouchLastUsed(ctx, owner.TokenID); err != nil {
+					logger.WarnContext(ctx, "api token last_used_at update failed", slog.Int64("token_id", owner.TokenID), slog.Any("error", err))
+				}
+				ctx = withUser(ctx, owner.UserID, owner.Role, "")
+				ctx = withAuth(ctx, AuthMethodToken, owner.Scopes())
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			cookie, err := r.Cookie("session_id")
 			if err != nil {
-				log.Printf("Error retrieving session cookie: %v", err)
-				http.Error(w, "Unauthorized: No session cookie", http.StatusUnauthorized)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized)
 				return
 			}
 			sessionID := cookie.Value
 
 			ctx := r.Context()
-			var userID int
+			span := trace.SpanFromContext(ctx)
 
 			// 1. Redisからセッション情報の取得を試みる
 			if redisClient != nil {
 				cacheKey := "session:" + sessionID
-				cachedUserID, err := redisClient.HGet(ctx, cacheKey, "user_id").Int()
+				vals, err := redisClient.HMGet(ctx, cacheKey, "user_id", "expires_at", "role").Result()
 
 				if err == nil {
-					// キャッシュヒット - セッション有効期限を確認
-					expiresAt, err := redisClient.HGet(ctx, cacheKey, "expires_at").Int64()
-					if err == nil && time.Now().Unix() < expiresAt {
-						// キャッシュからユーザーIDを取得して処理を続行
-						userID = cachedUserID
-						r = r.WithContext(context.WithValue(ctx, userContextKey, userID))
-						next.ServeHTTP(w, r)
-						return
-					}
+					userID, idErr := strconv.Atoi(fmt.Sprint(vals[0]))
+					expiresAt, expErr := strconv.ParseInt(fmt.Sprint(vals[1]), 10, 64)
+					role, _ := vals[2].(string)
 
-					// 有効期限切れの場合はキャッシュを削除
-					if err == nil && time.Now().Unix() >= expiresAt {
+					// キャッシュヒット - セッション有効期限を確認
+					// roleを持たない古いキャッシュはミス扱いとしてDBから再構築する
+					if idErr == nil && expErr == nil && role != "" {
+						if time.Now().Unix() < expiresAt {
+							// キャッシュからユーザー情報を取得して処理を続行
+							metrics.CacheHit(metrics.CacheSession)
+							span.SetAttributes(telemetry.AttrCacheHit.Bool(true))
+							ctx = withUser(ctx, userID, role, sessionID)
+							next.ServeHTTP(w, r.WithContext(withAuth(ctx, AuthMethodSession, nil)))
+							return
+						}
+						// 有効期限切れの場合はキャッシュを削除
 						redisClient.Del(ctx, cacheKey)
 					}
+				} else {
+					// Redis障害時はDBにフォールバックする
+					telemetry.CacheFallback(span, metrics.CacheSession, "redis_error", err)
 				}
+				metrics.CacheMiss(metrics.CacheSession)
+				span.SetAttributes(telemetry.AttrCacheHit.Bool(false))
 			}
 
 			// 2. キャッシュミスまたはRedisが使えない場合、DBから直接取得
-			dbUserID, err := sessionRepo.FindUserBySessionID(ctx, sessionID)
+			user, err := sessionRepo.FindUserBySessionID(ctx, sessionID)
 			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized)
 				return
 			}
 
-			userID = dbUserID
-
 			// 3. セッション情報をキャッシュに保存 (次回のためのキャッシュ再構築)
 			if redisClient != nil {
 				// DBからセッションの有効期限を取得
@@ -69,34 +117,100 @@ func UserAuthMiddleware(sessionRepo *repository.SessionRepository, redisClient *
 					// TODO: 共通化できそう
 					cacheKey := "session:" + sessionID
 					sessionData := map[string]interface{}{
-						"user_id":    userID,
+						"user_id":    user.UserID,
 						"expires_at": sessionInfo.ExpiresAt.Unix(),
+						"role":       user.Role,
 					}
 
 					// セッションと同じ期間キャッシュを保持
 					if err := redisClient.HSet(ctx, cacheKey, sessionData).Err(); err != nil {
-						log.Printf("[middleware] セッションキャッシュ保存失敗: %v", err)
+						logger.WarnContext(ctx, "session cache store failed", slog.Any("error", err))
 						// キャッシュ失敗はエラーとして扱わない（アプリケーション続行可能）
 					} else {
 						redisClient.Expire(ctx, cacheKey, time.Until(sessionInfo.ExpiresAt))
-						log.Printf("[middleware] セッションキャッシュ保存成功: %s", sessionID)
+						logger.DebugContext(ctx, "session cached", slog.String("session_id", logging.Redact(sessionID)))
 					}
 				}
 			}
 
-			ctx = context.WithValue(ctx, userContextKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			ctx = withUser(ctx, user.UserID, user.Role, sessionID)
+			next.ServeHTTP(w, r.WithContext(withAuth(ctx, AuthMethodSession, nil)))
+		})
+	}
+}
+
+// 認証済みユーザーのロールが許可されたロールのいずれかであることを要求する
+// UserAuthMiddlewareの後段で使用する
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := GetRoleFromContext(r.Context())
+			if !ok || !slices.Contains(roles, role) {
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIトークンで認証されたリクエストに指定スコープを要求する
+// セッション認証のリクエストは全てのスコープを持つものとして扱う
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if method, _ := GetAuthMethodFromContext(ctx); method == AuthMethodToken {
+				scopes, _ := ctx.Value(scopesContextKey).([]string)
+				if !slices.Contains(scopes, scope) {
+					apierror.Write(w, r, http.StatusForbidden, apierror.CodeInsufficientScope,
+						model.FieldError{Reason: "token lacks scope " + scope})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// セッション認証を要求する (APIトークンでは利用できない操作に使用)
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if method, _ := GetAuthMethodFromContext(r.Context()); method != AuthMethodSession {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeSessionRequired)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func withAuth(ctx context.Context, method string, scopes []string) context.Context {
+	ctx = context.WithValue(ctx, authMethodContextKey, method)
+	return context.WithValue(ctx, scopesContextKey, scopes)
+}
+
+func withUser(ctx context.Context, userID int, role, sessionID string) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, userID)
+	ctx = context.WithValue(ctx, roleContextKey, role)
+	return context.WithValue(ctx, sessionIDContextKey, sessionID)
+}
+
 func RobotAuthMiddleware(validAPIKey string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			apiKey := r.Header.Get("X-API-KEY")
 
 			if apiKey == "" || apiKey != validAPIKey {
-				http.Error(w, "Forbidden: Invalid or missing API key", http.StatusForbidden)
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeInvalidAPIKey)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -110,3 +224,21 @@ func GetUserFromContext(ctx context.Context) (int, bool) {
 	userID, ok := ctx.Value(userContextKey).(int)
 	return userID, ok
 }
+
+// コンテキストからユーザーのロールを取得
+func GetRoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roleContextKey).(string)
+	return role, ok
+}
+
+// コンテキストから認証方式(AuthMethodSession / AuthMethodToken)を取得
+func GetAuthMethodFromContext(ctx context.Context) (string, bool) {
+	method, ok := ctx.Value(authMethodContextKey).(string)
+	return method, ok
+}
+
+// コンテキストから現在のセッションIDを取得
+func GetSessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(sessionIDContextKey).(string)
+	return sessionID, ok
+}
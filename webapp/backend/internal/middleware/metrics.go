@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"backend/internal/metrics"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// ルートにマッチしなかったリクエストのrouteラベル
+// 生のパスをラベルにするとスキャン等でカーディナリティが爆発するため、まとめて記録する
+const unmatchedRoute = "unmatched"
+
+// ルートパターンごとのリクエスト数とレイテンシを記録する
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.ObserveHTTPRequest(r.Method, route, status, time.Since(start))
+	})
+}
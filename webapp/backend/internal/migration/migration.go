@@ -0,0 +1,110 @@
+// スキーママイグレーションの読み込みと適用
+//
+// webapp/mysql/migration の {番号}_{名前}.sql を番号順(同じ番号はファイル名順)に適用し、
+// schema_migrationsテーブルに適用済みのファイルとチェックサムを記録する。
+// restore_and_migration.sh も backend migrate up を実行するだけで、SQLファイルを直接は流さない。
+// ファイルの配置と命名は、以前シェルスクリプトがmysqlコマンドで実行していた頃のまま変えずに扱う。
+//
+// ロールバック用のSQLは down/{番号}_{名前}.sql に置く (任意)。
+// 旧スクリプトの ls {番号}_*.sql に拾われないよう、サブディレクトリに分けている
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ロールバック用SQLを置くサブディレクトリ
+const downDir = "down"
+
+// schema_migrationsの導入前にシェルスクリプトで実行されていたファイルの最大の番号
+// これらは記録がないまま一部だけ適用済みの環境があるため、重複エラーを適用済みとして扱う
+const legacyMaxVersion = 7
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// ファイル名が規則に合わないことを表すエラー
+var ErrInvalidFileName = errors.New("migration file name must be {version}_{name}.sql")
+
+type Migration struct {
+	Version int64
+	// ファイル名から番号と拡張子を除いた部分
+	// 同じ番号のファイルが複数あるため、VersionとNameの組で識別する
+	Name string
+	Up   string
+	// ロールバック用SQL (なければ空)
+	Down string
+	// UpのSHA-256 (16進数)
+	Checksum string
+}
+
+// ファイル名 (例: 2_placeholder.sql)
+func (m Migration) FileName() string {
+	return fmt.Sprintf("%d_%s.sql", m.Version, m.Name)
+}
+
+// schema_migrationsの導入前からあるファイルか
+func (m Migration) Legacy() bool {
+	return m.Version <= legacyMaxVersion
+}
+
+// 番号順、同じ番号はファイル名順に並べる
+func less(aVersion int64, aName string, bVersion int64, bName string) bool {
+	if aVersion != bVersion {
+		return aVersion < bVersion
+	}
+	return aName < bName
+}
+
+// fsysの直下にあるマイグレーションファイルを適用順に読み込む
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migration: read directory: %w", err)
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m := fileNamePattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration: %s: %w", e.Name(), ErrInvalidFileName)
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration: %s: %w", e.Name(), ErrInvalidFileName)
+		}
+
+		up, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migration: read %s: %w", e.Name(), err)
+		}
+		down, err := fs.ReadFile(fsys, path.Join(downDir, e.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("migration: read %s/%s: %w", downDir, e.Name(), err)
+		}
+
+		sum := sha256.Sum256(up)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     m[2],
+			Up:       string(up),
+			Down:     string(down),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return less(migrations[i].Version, migrations[i].Name, migrations[j].Version, migrations[j].Name)
+	})
+	return migrations, nil
+}
@@ -0,0 +1,53 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"10_add_order_events.sql":      {Data: []byte("CREATE TABLE order_events (id BIGINT);")},
+		"2_placeholder.sql":            {Data: []byte("SELECT 1;")},
+		"2_add_user_created_index.sql": {Data: []byte("CREATE INDEX idx ON users(created_at);")},
+		"down/10_add_order_events.sql": {Data: []byte("DROP TABLE order_events;")},
+		"README.md":                    {Data: []byte("not a migration")},
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := []struct {
+		file   string
+		legacy bool
+		down   bool
+	}{
+		{"2_add_user_created_index.sql", true, false},
+		{"2_placeholder.sql", true, false},
+		{"10_add_order_events.sql", false, true},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("Load returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		m := migrations[i]
+		if m.FileName() != w.file {
+			t.Errorf("migrations[%d] = %s, want %s", i, m.FileName(), w.file)
+		}
+		if m.Legacy() != w.legacy {
+			t.Errorf("%s: Legacy() = %v, want %v", m.FileName(), m.Legacy(), w.legacy)
+		}
+		if (m.Down != "") != w.down {
+			t.Errorf("%s: has down = %v, want %v", m.FileName(), m.Down != "", w.down)
+		}
+	}
+}
+
+func TestLoadInvalidFileName(t *testing.T) {
+	_, err := Load(fstest.MapFS{"add_indexes.sql": {Data: []byte("SELECT 1;")}})
+	if !errors.Is(err, ErrInvalidFileName) {
+		t.Errorf("Load error = %v, want ErrInvalidFileName", err)
+	}
+}
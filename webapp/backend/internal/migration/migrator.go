@@ -0,0 +1,344 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 複数のバックエンドが同時に起動してもマイグレーションが競合しないようにするロック名
+const lockName = "schema_migrations"
+
+const createTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    applied_at DATETIME NOT NULL,
+    PRIMARY KEY (version, name)
+)`
+
+var (
+	// 未適用のマイグレーションがある
+	ErrPending = errors.New("pending migrations")
+	// 適用後にファイルが書き換えられた
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// DBに記録されているがファイルが存在しない (DBの方が新しい)
+	ErrUnknownMigration = errors.New("applied migration not found in migration directory")
+	// ロールバック用SQLがない
+	ErrNoDown = errors.New("no down migration")
+	// 他のプロセスがマイグレーション中でロックを取得できなかった
+	ErrLockTimeout = errors.New("timed out waiting for migration lock")
+)
+
+// 既に目的の状態になっていることを表すMySQLのエラー番号
+// legacyMaxVersionまでのマイグレーションはシェルスクリプトで「重複エラー無視」として実行されてきたため、
+// これらのエラーはファイルを適用済みとして扱う
+var alreadyAppliedErrors = map[uint16]string{
+	1050: "table already exists",
+	1060: "duplicate column name",
+	1061: "duplicate key name",
+	1091: "column or key does not exist",
+}
+
+type Migrator struct {
+	db          *sql.DB
+	source      fs.FS
+	lockTimeout time.Duration
+	logger      *slog.Logger
+}
+
+func New(db *sql.DB, source fs.FS, lockTimeout time.Duration, logger *slog.Logger) *Migrator {
+	return &Migrator{db: db, source: source, lockTimeout: lockTimeout, logger: logger}
+}
+
+// 適用済みのマイグレーションの記録
+type applied struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// マイグレーションごとの状態
+type Status struct {
+	Version int64
+	Name    string
+	// 未適用の場合はnil
+	AppliedAt *time.Time
+	// 適用済みでチェックサムが一致しない
+	Modified bool
+	// 適用済みでファイルが存在しない
+	Missing bool
+}
+
+// 未適用のマイグレーションを全て適用し、適用した数を返す
+// 適用済みのファイルが書き換えられている場合は何も適用せずにエラーを返す
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	migrations, err := Load(m.source)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verify(migrations, done); err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if _, ok := done[key(mig.Version, mig.Name)]; ok {
+				continue
+			}
+			start := time.Now()
+			if err := m.exec(ctx, conn, mig.FileName(), mig.Up, mig.Legacy()); err != nil {
+				return fmt.Errorf("migration: apply %s: %w", mig.FileName(), err)
+			}
+			// DDLは暗黙的にコミットされトランザクションで囲めないため、成功したファイルごとに記録する
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				mig.Version, mig.Name, mig.Checksum, time.Now(),
+			); err != nil {
+				return fmt.Errorf("migration: record %s: %w", mig.FileName(), err)
+			}
+			count++
+			m.logger.InfoContext(ctx, "applied migration",
+				slog.String("file", mig.FileName()),
+				slog.Duration("elapsed", time.Since(start)),
+			)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// 番号の大きいものから順にsteps件のマイグレーションをロールバックし、戻した数を返す
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	migrations, err := Load(m.source)
+	if err != nil {
+		return 0, err
+	}
+	byKey := make(map[string]Migration, len(migrations))
+	for _, mig := range migrations {
+		byKey[key(mig.Version, mig.Name)] = mig
+	}
+
+	count := 0
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verify(migrations, done); err != nil {
+			return err
+		}
+		for _, a := range sortedDesc(done) {
+			if count >= steps {
+				break
+			}
+			mig := byKey[key(a.Version, a.Name)]
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migration: %s: %w (add %s/%s)", mig.FileName(), ErrNoDown, downDir, mig.FileName())
+			}
+			if err := m.exec(ctx, conn, downDir+"/"+mig.FileName(), mig.Down, mig.Legacy()); err != nil {
+				return fmt.Errorf("migration: roll back %s: %w", mig.FileName(), err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				"DELETE FROM schema_migrations WHERE version = ? AND name = ?", mig.Version, mig.Name,
+			); err != nil {
+				return fmt.Errorf("migration: unrecord %s: %w", mig.FileName(), err)
+			}
+			count++
+			m.logger.InfoContext(ctx, "rolled back migration", slog.String("file", mig.FileName()))
+		}
+		return nil
+	})
+	return count, err
+}
+
+// ファイルとDBの記録を突き合わせた状態を適用順に返す
+// DBにしか記録がないものは最後に並べる
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := Load(m.source)
+	if err != nil {
+		return nil, err
+	}
+	done, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, mig := range migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := done[key(mig.Version, mig.Name)]; ok {
+			appliedAt := a.AppliedAt
+			st.AppliedAt = &appliedAt
+			st.Modified = a.Checksum != mig.Checksum
+			delete(done, key(mig.Version, mig.Name))
+		}
+		statuses = append(statuses, st)
+	}
+	for _, a := range sortedDesc(done) {
+		appliedAt := a.AppliedAt
+		statuses = append(statuses, Status{Version: a.Version, Name: a.Name, AppliedAt: &appliedAt, Missing: true})
+	}
+	return statuses, nil
+}
+
+// スキーマがファイルと一致しているかを確認する
+// 未適用・書き換え・DBにしかないマイグレーションがあればエラーを返す
+func (m *Migrator) Check(ctx context.Context) error {
+	migrations, err := Load(m.source)
+	if err != nil {
+		return err
+	}
+	done, err := m.applied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	if err := verify(migrations, done); err != nil {
+		return err
+	}
+	var pending []string
+	for _, mig := range migrations {
+		if _, ok := done[key(mig.Version, mig.Name)]; !ok {
+			pending = append(pending, mig.FileName())
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("migration: %w: %s", ErrPending, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// 適用済みの記録とファイルを突き合わせる
+// チェックサムの不一致とDBにしかない記録をエラーにする
+func verify(migrations []Migration, done map[string]applied) error {
+	var errs []error
+	files := make(map[string]bool, len(migrations))
+	for _, mig := range migrations {
+		k := key(mig.Version, mig.Name)
+		files[k] = true
+		if a, ok := done[k]; ok && a.Checksum != mig.Checksum {
+			errs = append(errs, fmt.Errorf("migration: %s: %w (applied %s, file %s)",
+				mig.FileName(), ErrChecksumMismatch, a.Checksum[:12], mig.Checksum[:12]))
+		}
+	}
+	for _, a := range sortedDesc(done) {
+		if !files[key(a.Version, a.Name)] {
+			errs = append(errs, fmt.Errorf("migration: %d_%s.sql: %w", a.Version, a.Name, ErrUnknownMigration))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func key(version int64, name string) string {
+	return fmt.Sprintf("%d_%s", version, name)
+}
+
+func sortedDesc(done map[string]applied) []applied {
+	list := make([]applied, 0, len(done))
+	for _, a := range done {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return less(list[j].Version, list[j].Name, list[i].Version, list[i].Name)
+	})
+	return list
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// 適用済みの記録を取得する (テーブルがなければ作成する)
+func (m *Migrator) applied(ctx context.Context, q querier) (map[string]applied, error) {
+	if _, err := q.ExecContext(ctx, createTableSQL); err != nil {
+		return nil, fmt.Errorf("migration: create schema_migrations: %w", err)
+	}
+	rows, err := q.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("migration: read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[string]applied)
+	for rows.Next() {
+		var a applied
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("migration: read schema_migrations: %w", err)
+		}
+		done[key(a.Version, a.Name)] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migration: read schema_migrations: %w", err)
+	}
+	return done, nil
+}
+
+// SQLファイルを1文ずつ実行する
+// legacyの場合のみ、重複エラーが出たらシェルスクリプトのmysqlコマンドと同じく残りの文を実行せずに終える
+// (3_add_products_indexes.sqlのように、後続の文が単独では失敗するファイルがあるため)
+// それ以外のファイルは記録がなければ未適用のはずなので、重複エラーもそのまま失敗にする
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, file, src string, legacy bool) error {
+	for i, stmt := range splitStatements(src) {
+		_, err := conn.ExecContext(ctx, stmt)
+		var mysqlErr *mysql.MySQLError
+		if legacy && errors.As(err, &mysqlErr) {
+			if reason, ok := alreadyAppliedErrors[mysqlErr.Number]; ok {
+				m.logger.WarnContext(ctx, "migration is already applied, skipping the rest of the file",
+					slog.String("file", file),
+					slog.Int("statement", i+1),
+					slog.String("reason", reason),
+				)
+				return nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// GET_LOCKで排他してfnを実行する
+// ロックはセッション単位のため、取得から解放まで同じ接続を使う
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migration: acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	timeout := int(m.lockTimeout / time.Second)
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, timeout).Scan(&got); err != nil {
+		return fmt.Errorf("migration: acquire lock: %w", err)
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return fmt.Errorf("migration: %w (%s)", ErrLockTimeout, m.lockTimeout)
+	}
+	defer func() {
+		// ctxがキャンセルされていても解放できるよう、別のcontextを使う
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(releaseCtx, "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+			m.logger.Warn("failed to release migration lock", slog.Any("error", err))
+		}
+	}()
+
+	return fn(conn)
+}
@@ -0,0 +1,65 @@
+package migration
+
+import "strings"
+
+// SQLファイルを文ごとに分割する
+// DSNでmultiStatementsを有効にしていないため、1文ずつ実行する必要がある。
+// コメント(--、#、/* */)は取り除き、文字列・識別子の中の;では分割しない
+func splitStatements(src string) []string {
+	var (
+		stmts []string
+		buf   strings.Builder
+	)
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		buf.Reset()
+	}
+
+	r := []rune(src)
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 閉じ引用符まで読み飛ばす ('' のような重ねた引用符とバックスラッシュのエスケープに対応)
+			buf.WriteRune(c)
+			for i++; i < len(r); i++ {
+				buf.WriteRune(r[i])
+				if r[i] == '\\' && c != '`' && i+1 < len(r) {
+					i++
+					buf.WriteRune(r[i])
+					continue
+				}
+				if r[i] == c {
+					if i+1 < len(r) && r[i+1] == c {
+						i++
+						buf.WriteRune(r[i])
+						continue
+					}
+					break
+				}
+			}
+		case c == '#' || (c == '-' && i+1 < len(r) && r[i+1] == '-' && (i+2 == len(r) || isSpace(r[i+2]))):
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+			buf.WriteRune('\n')
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			for i += 2; i < len(r) && !(r[i] == '*' && i+1 < len(r) && r[i+1] == '/'); i++ {
+			}
+			i++
+			buf.WriteRune(' ')
+		case c == ';':
+			flush()
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+func isSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -2,13 +2,182 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+// ユーザーのロール
+const (
+	RoleStoreManager = "store_manager"
+	RoleAdmin        = "admin"
+	RoleOperator     = "operator"
+)
+
+// 定義済みのロールかどうかを判定する
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleStoreManager, RoleAdmin, RoleOperator:
+		return true
+	}
+	return false
+}
+
 type User struct {
-	UserID       int    `db:"user_id"`
-	PasswordHash string `db:"password_hash"`
-	UserName     string `db:"user_name"`
+	UserID       int    `db:"user_id"       json:"user_id"`
+	PasswordHash string `db:"password_hash" json:"-"`
+	UserName     string `db:"user_name"     json:"user_name"`
+	Role         string `db:"role"          json:"role"`
+}
+
+// APIトークンに付与できるスコープ
+const (
+	ScopeProductsRead = "products:read"
+	ScopeOrdersRead   = "orders:read"
+	ScopeOrdersWrite  = "orders:write"
+)
+
+// 定義済みのスコープかどうかを判定する
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeProductsRead, ScopeOrdersRead, ScopeOrdersWrite:
+		return true
+	}
+	return false
+}
+
+// パーソナルAPIトークン
+// トークン本体は作成時のレスポンスでのみ返し、DBにはハッシュのみを保存する
+type APIToken struct {
+	TokenID     int64      `db:"token_id"     json:"token_id"`
+	UserID      int        `db:"user_id"      json:"-"`
+	Name        string     `db:"name"         json:"name"`
+	TokenPrefix string     `db:"token_prefix" json:"token_prefix"`
+	ScopesRaw   string     `db:"scopes"       json:"-"`
+	Scopes      []string   `db:"-"            json:"scopes"`
+	CreatedAt   time.Time  `db:"created_at"   json:"created_at"`
+	LastUsedAt  *time.Time `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt   *time.Time `db:"expires_at"   json:"expires_at"`
+	RevokedAt   *time.Time `db:"revoked_at"   json:"revoked_at"`
+}
+
+// 注文の配送ステータス
+const (
+	OrderStatusShipping   = "shipping"
+	OrderStatusDelivering = "delivering"
+	OrderStatusCompleted  = "completed"
+	OrderStatusCancelled  = "cancelled"
+)
+
+// 定義済みの配送ステータスかどうかを判定する
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusShipping, OrderStatusDelivering, OrderStatusCompleted, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// 注文の履歴(order_events)に記録するイベントの種類
+const (
+	OrderEventCreated = "created"
+	// ロボットが配送計画に含めた
+	OrderEventClaimed   = "claimed"
+	OrderEventArrived   = "arrived"
+	OrderEventCancelled = "cancelled"
+	// 上記以外のステータスへの変更
+	OrderEventStatusChanged = "status_changed"
+)
+
+// 注文のイベントを起こした主体 (actor_type)
+const (
+	OrderActorUser  = "user"
+	OrderActorRobot = "robot"
+)
+
+// 注文のステータス変更の履歴1件
+type OrderEvent struct {
+	EventID   int64  `db:"event_id"    json:"event_id"`
+	OrderID   int64  `db:"order_id"    json:"order_id"`
+	EventType string `db:"event_type"  json:"event_type"`
+	// 作成時はnull
+	FromStatus *string `db:"from_status" json:"from_status"`
+	ToStatus   string  `db:"to_status"   json:"to_status"`
+	ActorType  string  `db:"actor_type"  json:"actor_type"`
+	// ユーザーIDまたはロボットID
+	ActorID string `db:"actor_id"    json:"actor_id"`
+	// ロボットが配送計画に含めた場合の計画ID
+	PlanID     *string   `db:"plan_id"     json:"plan_id"`
+	OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+}
+
+// Webhookで通知する注文のイベント
+const (
+	WebhookEventOrderCreated    = "order.created"
+	WebhookEventOrderDelivering = "order.delivering"
+	WebhookEventOrderArrived    = "order.arrived"
+)
+
+// 定義済みのWebhookイベントかどうかを判定する
+func IsValidWebhookEvent(eventType string) bool {
+	switch eventType {
+	case WebhookEventOrderCreated, WebhookEventOrderDelivering, WebhookEventOrderArrived:
+		return true
+	}
+	return false
+}
+
+// Webhookの送信状態
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	// 再試行の上限に達し、これ以上送信しない (手動で再送できる)
+	WebhookDeliveryDead = "dead"
+)
+
+// 店舗システムへの通知先
+// シークレットは作成時のレスポンスでのみ返す
+type Webhook struct {
+	WebhookID     int64     `db:"webhook_id"  json:"webhook_id"`
+	UserID        int       `db:"user_id"     json:"-"`
+	URL           string    `db:"url"         json:"url"`
+	Secret        string    `db:"secret"      json:"-"`
+	EventTypesRaw string    `db:"event_types" json:"-"`
+	EventTypes    []string  `db:"-"           json:"event_types"`
+	Active        bool      `db:"active"      json:"active"`
+	CreatedAt     time.Time `db:"created_at"  json:"created_at"`
+}
+
+// Webhookの送信1件 (送信待ちのイベントと送信結果の履歴を兼ねる)
+type WebhookDelivery struct {
+	DeliveryID     int64           `db:"delivery_id"      json:"delivery_id"`
+	WebhookID      int64           `db:"webhook_id"       json:"webhook_id"`
+	EventID        string          `db:"event_id"         json:"event_id"`
+	EventType      string          `db:"event_type"       json:"event_type"`
+	Payload        json.RawMessage `db:"payload"          json:"payload"`
+	Status         string          `db:"status"           json:"status"`
+	Attempts       int             `db:"attempts"         json:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at"  json:"next_attempt_at"`
+	LastStatusCode *int            `db:"last_status_code" json:"last_status_code"`
+	LastError      *string         `db:"last_error"       json:"last_error"`
+	CreatedAt      time.Time       `db:"created_at"       json:"created_at"`
+	DeliveredAt    *time.Time      `db:"delivered_at"     json:"delivered_at"`
+}
+
+// Webhookで送信するJSON
+// 再送しても同じIDになるため、受信側はIDで重複を除ける
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookOrderData `json:"data"`
+}
+
+type WebhookOrderData struct {
+	OrderID       int64      `json:"order_id"`
+	ProductID     int        `json:"product_id"`
+	ShippedStatus string     `json:"shipped_status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ArrivedAt     *time.Time `json:"arrived_at"`
 }
 
 type Product struct {
@@ -33,17 +202,107 @@ type Order struct {
 }
 
 type DeliveryPlan struct {
+	// 注文の履歴に記録する計画ID
+	PlanID      string  `json:"plan_id"`
 	RobotID     string  `json:"robot_id"`
 	TotalWeight int     `json:"total_weight"`
 	TotalValue  int     `json:"total_value"`
 	Orders      []Order `json:"orders"`
 }
 
+// 期間内の配送統計
+type DeliveryStats struct {
+	// 集計期間 [from, to)
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// 期間内に作成された注文の、現在のステータスごとの件数
+	StatusCounts map[string]int `json:"status_counts"`
+	// 期間内に到着した注文の、作成から到着までの時間
+	DeliveryTime DeliveryTimeStats `json:"delivery_time"`
+	// 期間内に作成された注文が多い商品 (上位のみ)
+	Products []ProductVolume `json:"products"`
+	// 期間内のロボットごとの配送実績
+	Robots      []RobotThroughput `json:"robots"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// 作成から到着までの秒数 (到着した注文がない場合はnull)
+type DeliveryTimeStats struct {
+	Delivered     int      `db:"delivered"      json:"delivered"`
+	AvgSeconds    *float64 `db:"avg_seconds"    json:"avg_seconds"`
+	MedianSeconds *int64   `db:"median_seconds" json:"median_seconds"`
+	P95Seconds    *int64   `db:"p95_seconds"    json:"p95_seconds"`
+}
+
+type ProductVolume struct {
+	ProductID int    `db:"product_id" json:"product_id"`
+	Name      string `db:"name"       json:"name"`
+	Orders    int    `db:"orders"     json:"orders"`
+	Delivered int    `db:"delivered"  json:"delivered"`
+}
+
+type RobotThroughput struct {
+	RobotID string `db:"robot_id" json:"robot_id"`
+	// 注文を含む配送計画の数と、計画に含めた注文数
+	Plans  int `db:"plans"  json:"plans"`
+	Orders int `db:"orders" json:"orders"`
+	// 到着を報告した注文数と、期間1時間あたりの件数
+	Delivered        int     `db:"delivered"      json:"delivered"`
+	DeliveredPerHour float64 `db:"-"              json:"delivered_per_hour"`
+	TotalWeight      int     `db:"total_weight"   json:"total_weight"`
+	TotalCapacity    int     `db:"total_capacity" json:"total_capacity"`
+	// 積載量に対する積載重量の割合 (0〜1)
+	CapacityUtilization float64 `db:"-" json:"capacity_utilization"`
+}
+
+// 注文ステータスの変更イベント
+// IDは全ユーザー共通の連番で、SSEのLast-Event-IDによる再送に使う
+type OrderStatusEvent struct {
+	ID         int64     `json:"id"`
+	OrderID    int64     `json:"order_id"`
+	UserID     int       `json:"user_id"`
+	Status     string    `json:"status"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
 type LoginRequest struct {
 	UserName string `json:"user_name"`
 	Password string `json:"password"`
 }
 
+type CreateUserRequest struct {
+	UserName string `json:"user_name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type CreateAPITokenResponse struct {
+	Token string `json:"token"`
+	APIToken
+}
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type CreateWebhookResponse struct {
+	// 署名の検証に使うシークレット (再取得できない)
+	Secret string `json:"secret"`
+	Webhook
+}
+
 type CreateOrderRequest struct {
 	Items []RequestItem `json:"items"`
 }
@@ -66,4 +325,57 @@ type ListRequest struct {
 	SortField string `json:"sort_field"`
 	SortOrder string `json:"sort_order"`
 	Offset    int    `json:"-"`
+	// 前のレスポンスのnext_cursor。指定した場合はpageの代わりにカーソルの続きから取得する
+	// (OFFSETを使わないため深いページでも遅くならない)
+	Cursor string `json:"cursor"`
+	// falseの場合は総件数の集計を省略する (未指定の場合は集計する)
+	IncludeTotal *bool `json:"include_total"`
+}
+
+// 総件数を集計するか
+func (r ListRequest) WantTotal() bool {
+	return r.IncludeTotal == nil || *r.IncludeTotal
+}
+
+// 注文履歴一覧の取得条件
+// 共通のページング・ソート条件に加えて、注文固有の絞り込み条件を持つ
+type OrderListRequest struct {
+	ListRequest
+	// いずれかのステータスに一致する注文に絞り込む (空の場合は全て)
+	Statuses  []string `json:"statuses"`
+	ProductID int      `json:"product_id"`
+	// 日時の範囲はFromを含みToを含まない ([from, to))
+	CreatedFrom *time.Time `json:"created_from"`
+	CreatedTo   *time.Time `json:"created_to"`
+	// 到着日時で絞り込んだ場合、未到着の注文は含まない
+	ArrivedFrom *time.Time `json:"arrived_from"`
+	ArrivedTo   *time.Time `json:"arrived_to"`
+}
+
+// 一覧取得のページ情報
+type PageInfo struct {
+	// 総件数 (ListRequest.IncludeTotalがfalseの場合はnil)
+	Total *int `json:"total,omitempty"`
+	// 次のページを取得するカーソル (続きがない場合は空)
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ヘルスチェックの状態
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusDegraded    = "degraded"
+	HealthStatusUnavailable = "unavailable"
+	HealthStatusUnknown     = "unknown"
+)
+
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Version   string  `json:"version,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
 }
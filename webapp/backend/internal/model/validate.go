@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// リクエストボディの上限値
+const (
+	MaxOrderItems    = 100
+	MaxOrderQuantity = 100
+	MaxPageSize      = 100
+)
+
+// 検証に失敗したフィールド
+type FieldError struct {
+	// JSONのフィールド名 (配列の要素は items[0].quantity の形式)
+	// 特定のフィールドに対応しない詳細の場合は空
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// エラーレスポンスのJSON
+type ErrorResponse struct {
+	// 機械的に判定するためのエラーコード (invalid_json, validation_failed など)
+	Code string `json:"code"`
+	// 利用者向けのメッセージ (Accept-Languageに応じて日本語か英語)
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+	// X-Request-IDと同じ値。問い合わせの際にログと突き合わせる
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// デコード後に検証するリクエストボディ
+type Validator interface {
+	// 違反しているフィールドを全て返す (問題がなければnil)
+	Validate() []FieldError
+}
+
+func (r LoginRequest) Validate() []FieldError {
+	var errs []FieldError
+	if r.UserName == "" {
+		errs = append(errs, FieldError{"user_name", "is required"})
+	}
+	if r.Password == "" {
+		errs = append(errs, FieldError{"password", "is required"})
+	}
+	return errs
+}
+
+func (r CreateOrderRequest) Validate() []FieldError {
+	if len(r.Items) == 0 {
+		return []FieldError{{"items", "must contain at least one item"}}
+	}
+	if len(r.Items) > MaxOrderItems {
+		return []FieldError{{"items", fmt.Sprintf("must contain at most %d items", MaxOrderItems)}}
+	}
+	var errs []FieldError
+	for i, item := range r.Items {
+		if item.ProductID < 1 {
+			errs = append(errs, FieldError{fmt.Sprintf("items[%d].product_id", i), "must be a positive integer"})
+		}
+		if item.Quantity < 1 || item.Quantity > MaxOrderQuantity {
+			errs = append(errs, FieldError{fmt.Sprintf("items[%d].quantity", i), fmt.Sprintf("must be between 1 and %d", MaxOrderQuantity)})
+		}
+	}
+	return errs
+}
+
+func (r UpdateOrderStatusRequest) Validate() []FieldError {
+	var errs []FieldError
+	if r.OrderID < 1 {
+		errs = append(errs, FieldError{"order_id", "must be a positive integer"})
+	}
+	if !IsValidOrderStatus(r.NewStatus) {
+		errs = append(errs, FieldError{"new_status", "must be one of shipping, delivering, completed, cancelled"})
+	}
+	return errs
+}
+
+// 0や空の値は既定値として扱うため、負の値や範囲外の値のみを拒否する
+func (r ListRequest) Validate() []FieldError {
+	var errs []FieldError
+	if r.Page < 0 {
+		errs = append(errs, FieldError{"page", "must not be negative"})
+	}
+	// 0は省略時と同じく既定の件数になる
+	if r.PageSize < 0 || r.PageSize > MaxPageSize {
+		errs = append(errs, FieldError{"page_size", fmt.Sprintf("must be between 0 and %d", MaxPageSize)})
+	}
+	if r.SortOrder != "" && !strings.EqualFold(r.SortOrder, "asc") && !strings.EqualFold(r.SortOrder, "desc") {
+		errs = append(errs, FieldError{"sort_order", "must be asc or desc"})
+	}
+	return errs
+}
+
+func (r OrderListRequest) Validate() []FieldError {
+	errs := r.ListRequest.Validate()
+	for i, status := range r.Statuses {
+		if !IsValidOrderStatus(status) {
+			errs = append(errs, FieldError{fmt.Sprintf("statuses[%d]", i), "must be one of shipping, delivering, completed, cancelled"})
+		}
+	}
+	if r.ProductID < 0 {
+		errs = append(errs, FieldError{"product_id", "must not be negative"})
+	}
+	// 範囲は[from, to)のため、同じ日時も空の範囲として拒否する
+	if r.CreatedFrom != nil && r.CreatedTo != nil && !r.CreatedFrom.Before(*r.CreatedTo) {
+		errs = append(errs, FieldError{"created_from", "must be before created_to"})
+	}
+	if r.ArrivedFrom != nil && r.ArrivedTo != nil && !r.ArrivedFrom.Before(*r.ArrivedTo) {
+		errs = append(errs, FieldError{"arrived_from", "must be before arrived_to"})
+	}
+	return errs
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderListRequestValidate(t *testing.T) {
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	for _, tc := range []struct {
+		name string
+		req  OrderListRequest
+		want []FieldError
+	}{
+		{"empty filter", OrderListRequest{}, nil},
+		{"valid filter", OrderListRequest{
+			Statuses:    []string{OrderStatusShipping, OrderStatusShipping, OrderStatusCompleted},
+			ProductID:   3,
+			CreatedFrom: &from, CreatedTo: &to,
+		}, nil},
+		{"unknown status", OrderListRequest{Statuses: []string{OrderStatusShipping, "lost"}}, []FieldError{
+			{"statuses[1]", "must be one of shipping, delivering, completed, cancelled"},
+		}},
+		{"negative product", OrderListRequest{ProductID: -1}, []FieldError{
+			{"product_id", "must not be negative"},
+		}},
+		{"empty created range", OrderListRequest{CreatedFrom: &from, CreatedTo: &from}, []FieldError{
+			{"created_from", "must be before created_to"},
+		}},
+		{"reversed arrived range", OrderListRequest{ArrivedFrom: &to, ArrivedTo: &from}, []FieldError{
+			{"arrived_from", "must be before arrived_to"},
+		}},
+		{"default page size", OrderListRequest{ListRequest: ListRequest{PageSize: 0}}, nil},
+		{"page size too large", OrderListRequest{ListRequest: ListRequest{PageSize: MaxPageSize + 1}}, []FieldError{
+			{"page_size", "must be between 0 and 100"},
+		}},
+		{"list and filter errors together", OrderListRequest{ListRequest: ListRequest{Page: -1}, ProductID: -1}, []FieldError{
+			{"page", "must not be negative"},
+			{"product_id", "must not be negative"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.req.Validate(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Validate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"backend/internal/telemetry"
+	"context"
+	"strings"
+	"time"
+)
+
+type APITokenRepository struct {
+	db DBTX
+}
+
+func NewAPITokenRepository(db DBTX) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// Bearer認証で解決されるトークンの所有者情報
+type APITokenOwner struct {
+	TokenID   int64  `db:"token_id"`
+	UserID    int    `db:"user_id"`
+	Role      string `db:"role"`
+	ScopesRaw string `db:"scopes"`
+}
+
+func (o *APITokenOwner) Scopes() []string {
+	return strings.Fields(o.ScopesRaw)
+}
+
+// トークンを保存し、生成されたトークンIDを返す
+func (r *APITokenRepository) Create(ctx context.Context, token *model.APIToken, tokenHash string) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "APITokenRepository.Create", telemetry.AttrUserID.Int(token.UserID))
+	defer func() { telemetry.End(span, err) }()
+
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query,
+		token.UserID, token.Name, token.TokenPrefix, tokenHash,
+		strings.Join(token.Scopes, " "), token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ユーザーのトークン一覧を取得 (失効済みを含む)
+func (r *APITokenRepository) ListByUser(ctx context.Context, userID int) (_ []model.APIToken, err error) {
+	ctx, span := startSpan(ctx, "APITokenRepository.ListByUser", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	var tokens []model.APIToken
+	query := `
+		SELECT token_id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at, revoked_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY token_id DESC`
+	if err := r.db.SelectContext(ctx, &tokens, query, userID); err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		tokens[i].Scopes = strings.Fields(tokens[i].ScopesRaw)
+	}
+	return tokens, nil
+}
+
+// トークンを失効させる
+// 対象が存在しない、他人のトークン、または失効済みの場合はfalseを返す
+func (r *APITokenRepository) Revoke(ctx context.Context, userID int, tokenID int64) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "APITokenRepository.Revoke", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	query := "UPDATE api_tokens SET revoked_at = ? WHERE token_id = ? AND user_id = ? AND revoked_at IS NULL"
+	result, err := r.db.ExecContext(ctx, query, time.Now(), tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ハッシュから有効な(未失効・期限内の)トークンと所有者のロールを取得
+func (r *APITokenRepository) FindActiveByHash(ctx context.Context, tokenHash string) (_ *APITokenOwner, err error) {
+	ctx, span := startSpan(ctx, "APITokenRepository.FindActiveByHash")
+	defer func() { telemetry.End(span, err) }()
+
+	var owner APITokenOwner
+	query := `
+		SELECT t.token_id, t.user_id, u.role, t.scopes
+		FROM api_tokens t
+		JOIN users u ON u.user_id = t.user_id
+		WHERE t.token_hash = ?
+		  AND t.revoked_at IS NULL
+		  AND (t.expires_at IS NULL OR t.expires_at > ?)`
+	if err := r.db.GetContext(ctx, &owner, query, tokenHash, time.Now()); err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+// 最終利用日時を更新する
+// 毎リクエストの書き込みを避けるため、1分以内に更新済みであれば何もしない
+func (r *APITokenRepository) TouchLastUsed(ctx context.Context, tokenID int64) (err error) {
+	ctx, span := startSpan(ctx, "APITokenRepository.TouchLastUsed")
+	defer func() { telemetry.End(span, err) }()
+
+	now := time.Now()
+	query := "UPDATE api_tokens SET last_used_at = ? WHERE token_id = ? AND (last_used_at IS NULL OR last_used_at < ?)"
+	_, err = r.db.ExecContext(ctx, query, now, tokenID, now.Add(-time.Minute))
+	return err
+}
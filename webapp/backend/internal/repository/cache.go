@@ -4,6 +4,7 @@ package repository
 
 import (
 	"backend/internal/model"
+	"backend/internal/telemetry"
 	"context"
 	"fmt"
 	"sync"
@@ -12,12 +13,12 @@ import (
 // キャッシュに保存するデータ構造
 type productCacheEntry struct {
 	Products []model.Product
-	Total    int
+	Page     model.PageInfo
 }
 
 // ProductRepositoryの振る舞いを定義するインターフェース
 type IProductRepository interface {
-	ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error)
+	ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, model.PageInfo, error)
 }
 
 // キャッシュ機能を持つリポジトリ
@@ -38,9 +39,12 @@ func NewCachingProductRepository(next IProductRepository) *CachingProductReposit
 // cache.go (続き)
 
 // ListProductsはまずキャッシュを確認し、なければDBに問い合わせる
-func (r *CachingProductRepository) ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error) {
+func (r *CachingProductRepository) ListProducts(ctx context.Context, userID int, req model.ListRequest) (_ []model.Product, _ model.PageInfo, err error) {
+	ctx, span := startSpan(ctx, "CachingProductRepository.ListProducts", telemetry.AttrCacheName.String("product_local"))
+	defer func() { telemetry.End(span, err) }()
+
 	// 1. リクエスト情報からユニークなキャッシュキーを生成
-	key := fmt.Sprintf("products:%s:%s:%s:%d:%d", req.Search, req.SortField, req.SortOrder, req.PageSize, req.Offset)
+	key := fmt.Sprintf("products:%s:%s:%s:%d:%d:%s:%t", req.Search, req.SortField, req.SortOrder, req.PageSize, req.Offset, req.Cursor, req.WantTotal())
 
 	// 2. キャッシュの読み取りロック
 	r.rwLock.RLock()
@@ -48,14 +52,15 @@ func (r *CachingProductRepository) ListProducts(ctx context.Context, userID int,
 	r.rwLock.RUnlock()
 
 	// 3. キャッシュヒットした場合、その値を返す
+	span.SetAttributes(telemetry.AttrCacheHit.Bool(found))
 	if found {
-		return entry.Products, entry.Total, nil
+		return entry.Products, entry.Page, nil
 	}
 
 	// 4. キャッシュミスした場合、DBに問い合わせる
-	products, total, err := r.next.ListProducts(ctx, userID, req)
+	products, page, err := r.next.ListProducts(ctx, userID, req)
 	if err != nil {
-		return nil, 0, err
+		return nil, page, err
 	}
 
 	// 5. 結果をキャッシュに書き込む（書き込みロック）
@@ -63,8 +68,15 @@ func (r *CachingProductRepository) ListProducts(ctx context.Context, userID int,
 	defer r.rwLock.Unlock()
 	r.cache[key] = productCacheEntry{
 		Products: products,
-		Total:    total,
+		Page:     page,
 	}
 
-	return products, total, nil
-}
\ No newline at end of file
+	return products, page, nil
+}
+
+// キャッシュしているエントリ数
+func (r *CachingProductRepository) Len() int {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+	return len(r.cache)
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// カーソルが壊れている、または別の並び順で発行されたことを表すエラー
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 一覧のキーセットページング用のカーソル
+// クライアントには中身を解釈させないよう、JSONをbase64urlでエンコードした文字列として渡す
+type listCursor struct {
+	SortField string `json:"f"`
+	SortOrder string `json:"o"`
+	// 最後の行のソートキーの値 (NULLの場合はnil、日時はRFC3339形式の文字列)
+	Value any `json:"v"`
+	// 最後の行のID (ソートキーが同じ行の順序を決めるタイブレーカー)
+	ID int64 `json:"id"`
+}
+
+func encodeCursor(c listCursor) string {
+	if t, ok := c.Value.(time.Time); ok {
+		c.Value = t.Format(time.RFC3339Nano)
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var c listCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ソートキーの値の型
+type sortKind int
+
+const (
+	sortInt sortKind = iota
+	sortString
+	sortTime
+)
+
+// 並び替え可能な列
+type sortColumn struct {
+	// SQL上の式
+	expr string
+	kind sortKind
+	// NULLを含みうるか (MySQLではNULLが最小として並ぶ)
+	nullable bool
+}
+
+// 並び順とカーソル位置から、ORDER BY句とカーソル以降の行を絞り込む条件を組み立てる
+type keyset struct {
+	field  string
+	column sortColumn
+	desc   bool
+	// タイブレーカーのID列と並び順
+	idExpr string
+	idDesc bool
+}
+
+func (k keyset) direction(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func (k keyset) orderBy() string {
+	if k.column.expr == k.idExpr {
+		return " ORDER BY " + k.idExpr + " " + k.direction(k.desc)
+	}
+	return " ORDER BY " + k.column.expr + " " + k.direction(k.desc) + ", " + k.idExpr + " " + k.direction(k.idDesc)
+}
+
+// 並び順に合ったカーソルから、その位置より後ろの行に絞り込む条件を返す
+func (k keyset) after(encoded string) (string, []interface{}, error) {
+	c, err := decodeCursor(encoded)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.SortField != k.field || !strings.EqualFold(c.SortOrder, k.direction(k.desc)) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	cmp := func(desc bool) string {
+		if desc {
+			return "<"
+		}
+		return ">"
+	}
+	if k.column.expr == k.idExpr {
+		return k.idExpr + " " + cmp(k.desc) + " ?", []interface{}{c.ID}, nil
+	}
+
+	col, id := k.column.expr, k.idExpr
+	if c.Value == nil {
+		if !k.column.nullable {
+			return "", nil, ErrInvalidCursor
+		}
+		// NULLは昇順では先頭、降順では末尾に並ぶ
+		if k.desc {
+			return "(" + col + " IS NULL AND " + id + " " + cmp(k.idDesc) + " ?)", []interface{}{c.ID}, nil
+		}
+		return "((" + col + " IS NULL AND " + id + " " + cmp(k.idDesc) + " ?) OR " + col + " IS NOT NULL)",
+			[]interface{}{c.ID}, nil
+	}
+
+	value, err := k.parseValue(c.Value)
+	if err != nil {
+		return "", nil, err
+	}
+	cond := "(" + col + " " + cmp(k.desc) + " ? OR (" + col + " = ? AND " + id + " " + cmp(k.idDesc) + " ?)"
+	if k.column.nullable && k.desc {
+		cond += " OR " + col + " IS NULL"
+	}
+	return cond + ")", []interface{}{value, value, c.ID}, nil
+}
+
+func (k keyset) parseValue(v any) (interface{}, error) {
+	switch k.column.kind {
+	case sortInt:
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		}
+	case sortString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case sortTime:
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return nil, ErrInvalidCursor
+}
+
+// 条件をANDで結合したWHERE句 (条件がなければ空)
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// 最後の行のソートキーとIDから次のページのカーソルを作る
+func (k keyset) next(value any, id int64) string {
+	return encodeCursor(listCursor{
+		SortField: k.field,
+		SortOrder: k.direction(k.desc),
+		Value:     value,
+		ID:        id,
+	})
+}
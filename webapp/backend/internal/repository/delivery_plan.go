@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"backend/internal/telemetry"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// 配送計画の記録 (delivery_plans)
+type DeliveryPlanRepository struct {
+	db DBTX
+}
+
+func NewDeliveryPlanRepository(db DBTX) *DeliveryPlanRepository {
+	return &DeliveryPlanRepository{db: db}
+}
+
+// 配送計画を記録する
+// 注文のステータス更新と同じトランザクションで呼ぶこと
+func (r *DeliveryPlanRepository) Create(ctx context.Context, plan model.DeliveryPlan, capacity int, createdAt time.Time) (err error) {
+	ctx, span := startSpan(ctx, "DeliveryPlanRepository.Create",
+		attribute.String("robot.id", plan.RobotID), attribute.Int("plan.orders_count", len(plan.Orders)))
+	defer func() { telemetry.End(span, err) }()
+
+	query := `
+		INSERT INTO delivery_plans (plan_id, robot_id, capacity, total_weight, total_value, order_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.ExecContext(ctx, query,
+		plan.PlanID, plan.RobotID, capacity, plan.TotalWeight, plan.TotalValue, len(plan.Orders), createdAt)
+	return err
+}
@@ -5,20 +5,27 @@ package repository
 
 import (
 	"backend/internal/model"
+	"backend/internal/telemetry"
 	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type OrderRepository struct {
 	db DBTX
+	// 一覧取得に使う読み取り用の接続 (レプリカがなければdbと同じ)
+	reader DBTX
 }
 
 // 複数注文をバルクインサートし、生成された注文IDを返す
-func (r *OrderRepository) CreateBulk(ctx context.Context, orders []model.Order) ([]string, error) {
+func (r *OrderRepository) CreateBulk(ctx context.Context, orders []model.Order) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.CreateBulk", telemetry.AttrOrdersCreated.Int(len(orders)))
+	defer func() { telemetry.End(span, err) }()
+
 	if len(orders) == 0 {
 		return nil, nil
 	}
@@ -46,12 +53,15 @@ func (r *OrderRepository) CreateBulk(ctx context.Context, orders []model.Order)
 	return ids, nil
 }
 
-func NewOrderRepository(db DBTX) *OrderRepository {
-	return &OrderRepository{db: db}
+func NewOrderRepository(db, reader DBTX) *OrderRepository {
+	return &OrderRepository{db: db, reader: reader}
 }
 
 // 注文を作成し、生成された注文IDを返す
-func (r *OrderRepository) Create(ctx context.Context, order *model.Order) (string, error) {
+func (r *OrderRepository) Create(ctx context.Context, order *model.Order) (_ string, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.Create", telemetry.AttrUserID.Int(order.UserID))
+	defer func() { telemetry.End(span, err) }()
+
 	query := `INSERT INTO orders (user_id, product_id, shipped_status, created_at) VALUES (?, ?, 'shipping', NOW())`
 	result, err := r.db.ExecContext(ctx, query, order.UserID, order.ProductID)
 	if err != nil {
@@ -66,11 +76,19 @@ func (r *OrderRepository) Create(ctx context.Context, order *model.Order) (strin
 
 // 複数の注文IDのステータスを一括で更新
 // 主に配送ロボットが注文を引き受けた際に一括更新をするために使用
-func (r *OrderRepository) UpdateStatuses(ctx context.Context, orderIDs []int64, newStatus string) error {
+func (r *OrderRepository) UpdateStatuses(ctx context.Context, orderIDs []int64, newStatus string) (err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.UpdateStatuses", telemetry.AttrOrdersUpdated.Int(len(orderIDs)), telemetry.AttrOrderStatus.String(newStatus))
+	defer func() { telemetry.End(span, err) }()
+
 	if len(orderIDs) == 0 {
 		return nil
 	}
-	query, args, err := sqlx.In("UPDATE orders SET shipped_status = ? WHERE order_id IN (?)", newStatus, orderIDs)
+	set := "shipped_status = ?"
+	if newStatus == model.OrderStatusCompleted {
+		// 到着時刻は最初に完了になった時刻にする (作成時刻と同じくDBの時刻)
+		set += ", arrived_at = COALESCE(arrived_at, NOW())"
+	}
+	query, args, err := sqlx.In("UPDATE orders SET "+set+" WHERE order_id IN (?)", newStatus, orderIDs)
 	if err != nil {
 		return err
 	}
@@ -79,8 +97,66 @@ func (r *OrderRepository) UpdateStatuses(ctx context.Context, orderIDs []int64,
 	return err
 }
 
+// 注文IDごとに注文したユーザーのIDを取得
+// 存在しない注文IDは結果に含まれない
+func (r *OrderRepository) GetUserIDs(ctx context.Context, orderIDs []int64) (_ map[int64]int, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.GetUserIDs")
+	defer func() { telemetry.End(span, err) }()
+
+	if len(orderIDs) == 0 {
+		return map[int64]int{}, nil
+	}
+	query, args, err := sqlx.In("SELECT order_id, user_id FROM orders WHERE order_id IN (?)", orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		OrderID int64 `db:"order_id"`
+		UserID  int   `db:"user_id"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	owners := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		owners[row.OrderID] = row.UserID
+	}
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(owners)))
+	return owners, nil
+}
+
+// 注文IDごとの現在のステータスを取得し、トランザクションの終了まで行をロックする
+// 存在しない注文IDは結果に含まれない。トランザクション内で呼ぶこと
+func (r *OrderRepository) LockStatuses(ctx context.Context, orderIDs []int64) (_ map[int64]string, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.LockStatuses")
+	defer func() { telemetry.End(span, err) }()
+
+	if len(orderIDs) == 0 {
+		return map[int64]string{}, nil
+	}
+	query, args, err := sqlx.In("SELECT order_id, shipped_status FROM orders WHERE order_id IN (?) FOR UPDATE", orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		OrderID int64  `db:"order_id"`
+		Status  string `db:"shipped_status"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	statuses := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		statuses[row.OrderID] = row.Status
+	}
+	return statuses, nil
+}
+
 // 配送中(shipped_status:shipping)の注文一覧を取得
-func (r *OrderRepository) GetShippingOrders(ctx context.Context) ([]model.Order, error) {
+func (r *OrderRepository) GetShippingOrders(ctx context.Context) (_ []model.Order, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.GetShippingOrders")
+	defer func() { telemetry.End(span, err) }()
+
 	var orders []model.Order
 	query := `
         SELECT
@@ -91,12 +167,53 @@ func (r *OrderRepository) GetShippingOrders(ctx context.Context) ([]model.Order,
         JOIN products p ON o.product_id = p.product_id
         WHERE o.shipped_status = 'shipping'
     `
-	err := r.db.SelectContext(ctx, &orders, query)
+	err = r.db.SelectContext(ctx, &orders, query)
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(orders)))
 	return orders, err
 }
 
+// ステータスごとの注文数を集計
+func (r *OrderRepository) CountByStatus(ctx context.Context) (_ map[string]int, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.CountByStatus")
+	defer func() { telemetry.End(span, err) }()
+
+	var rows []struct {
+		Status string `db:"shipped_status"`
+		Count  int    `db:"cnt"`
+	}
+	query := `SELECT shipped_status, COUNT(*) AS cnt FROM orders GROUP BY shipped_status`
+	if err := r.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// 並び替え可能な注文の列
+var orderSortColumns = map[string]sortColumn{
+	"order_id":       {expr: "o.order_id", kind: sortInt},
+	"product_name":   {expr: "p.name", kind: sortString},
+	"created_at":     {expr: "o.created_at", kind: sortTime},
+	"shipped_status": {expr: "o.shipped_status", kind: sortString},
+	"arrived_at":     {expr: "o.arrived_at", kind: sortTime, nullable: true},
+}
+
 // 注文履歴一覧を取得
-func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.ListRequest) ([]model.Order, int, error) {
+// req.Cursorがあればキーセット、なければOFFSETでページングする
+func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.OrderListRequest) (_ []model.Order, _ model.PageInfo, err error) {
+	ctx, span := startSpan(ctx, "OrderRepository.ListOrders",
+		append(telemetry.ListAttributes(req.Page, req.PageSize, req.Search, req.SortField),
+			telemetry.AttrUserID.Int(userID), telemetry.AttrListCursor.Bool(req.Cursor != ""),
+			telemetry.AttrListFilterStatuses.StringSlice(req.Statuses),
+			telemetry.AttrListFilterProductID.Int(req.ProductID),
+			telemetry.AttrListFilterDateRange.Bool(req.CreatedFrom != nil || req.CreatedTo != nil || req.ArrivedFrom != nil || req.ArrivedTo != nil))...)
+	defer func() { telemetry.End(span, err) }()
+
+	var page model.PageInfo
+
 	// SQL JOIN・検索・ソート・ページングで一括取得
 	var conditions []string
 	var args []interface{}
@@ -111,40 +228,45 @@ func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.
 			args = append(args, "%"+req.Search+"%")
 		}
 	}
-	whereClause := " WHERE " + strings.Join(conditions, " AND ")
+	filterConds, filterArgs := orderFilterConditions(req)
+	conditions = append(conditions, filterConds...)
+	args = append(args, filterArgs...)
 
 	// 件数取得
-	countQuery := `SELECT COUNT(*) FROM orders o JOIN products p ON o.product_id = p.product_id` + whereClause
-	var total int
-	if err := r.db.GetContext(ctx, &total, countQuery, args...); err != nil {
-		return nil, 0, err
+	if req.WantTotal() {
+		countQuery := `SELECT COUNT(*) FROM orders o JOIN products p ON o.product_id = p.product_id` + whereClause(conditions)
+		var total int
+		if err := r.reader.GetContext(ctx, &total, countQuery, args...); err != nil {
+			return nil, page, err
+		}
+		page.Total = &total
+		span.SetAttributes(telemetry.AttrResultTotal.Int(total))
 	}
 
-	// ソート
-	orderClause := " ORDER BY "
-	switch req.SortField {
-	case "product_name":
-		orderClause += "p.name"
-	case "created_at":
-		orderClause += "o.created_at"
-	case "shipped_status":
-		orderClause += "o.shipped_status"
-	case "arrived_at":
-		orderClause += "o.arrived_at"
-	case "order_id":
-		fallthrough
-	default:
-		orderClause += "o.order_id"
-	}
-	if strings.ToUpper(req.SortOrder) == "DESC" {
-		orderClause += " DESC"
-	} else {
-		orderClause += " ASC"
+	// ソート (同じ値の注文は注文IDで並べ、ページをまたいでも順序が変わらないようにする)
+	column, ok := orderSortColumns[req.SortField]
+	if !ok {
+		req.SortField, column = "order_id", orderSortColumns["order_id"]
 	}
+	desc := strings.ToUpper(req.SortOrder) == "DESC"
+	ks := keyset{field: req.SortField, column: column, desc: desc, idExpr: "o.order_id", idDesc: desc}
 
 	// ページング
-	dataQuery := `SELECT o.order_id, o.product_id, p.name AS product_name, o.shipped_status, o.created_at, o.arrived_at FROM orders o JOIN products p ON o.product_id = p.product_id` + whereClause + orderClause + " LIMIT ? OFFSET ?"
-	argsData := append(args, req.PageSize, req.Offset)
+	// 次のページの有無を判定するため、1件多く取得する
+	limitClause := " LIMIT ? OFFSET ?"
+	pageArgs := []interface{}{req.PageSize + 1, req.Offset}
+	if req.Cursor != "" {
+		cond, cursorArgs, err := ks.after(req.Cursor)
+		if err != nil {
+			return nil, page, err
+		}
+		conditions = append(conditions, cond)
+		args = append(args, cursorArgs...)
+		limitClause = " LIMIT ?"
+		pageArgs = pageArgs[:1]
+	}
+	dataQuery := `SELECT o.order_id, o.product_id, p.name AS product_name, o.shipped_status, o.created_at, o.arrived_at FROM orders o JOIN products p ON o.product_id = p.product_id` + whereClause(conditions) + ks.orderBy() + limitClause
+	argsData := append(args, pageArgs...)
 
 	type orderRow struct {
 		OrderID       int          `db:"order_id"`
@@ -155,8 +277,8 @@ func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.
 		ArrivedAt     sql.NullTime `db:"arrived_at"`
 	}
 	var rows []orderRow
-	if err := r.db.SelectContext(ctx, &rows, dataQuery, argsData...); err != nil {
-		return nil, 0, err
+	if err := r.reader.SelectContext(ctx, &rows, dataQuery, argsData...); err != nil {
+		return nil, page, err
 	}
 
 	var orders []model.Order
@@ -171,5 +293,64 @@ func (r *OrderRepository) ListOrders(ctx context.Context, userID int, req model.
 		})
 	}
 
-	return orders, total, nil
+	if len(orders) > req.PageSize {
+		orders = orders[:req.PageSize]
+		last := orders[len(orders)-1]
+		page.NextCursor = ks.next(orderSortValue(last, req.SortField), last.OrderID)
+	}
+
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(orders)))
+	return orders, page, nil
+}
+
+// 注文固有の絞り込み条件
+// 日時の範囲はFromを含みToを含まない
+func orderFilterConditions(req model.OrderListRequest) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if len(req.Statuses) > 0 {
+		conditions = append(conditions, "o.shipped_status IN (?"+strings.Repeat(", ?", len(req.Statuses)-1)+")")
+		for _, status := range req.Statuses {
+			args = append(args, status)
+		}
+	}
+	if req.ProductID > 0 {
+		conditions = append(conditions, "o.product_id = ?")
+		args = append(args, req.ProductID)
+	}
+	ranges := []struct {
+		column   string
+		from, to *time.Time
+	}{
+		{"o.created_at", req.CreatedFrom, req.CreatedTo},
+		{"o.arrived_at", req.ArrivedFrom, req.ArrivedTo},
+	}
+	for _, rg := range ranges {
+		if rg.from != nil {
+			conditions = append(conditions, rg.column+" >= ?")
+			args = append(args, *rg.from)
+		}
+		if rg.to != nil {
+			conditions = append(conditions, rg.column+" < ?")
+			args = append(args, *rg.to)
+		}
+	}
+	return conditions, args
+}
+
+func orderSortValue(o model.Order, field string) any {
+	switch field {
+	case "product_name":
+		return o.ProductName
+	case "created_at":
+		return o.CreatedAt
+	case "shipped_status":
+		return o.ShippedStatus
+	case "arrived_at":
+		if !o.ArrivedAt.Valid {
+			return nil
+		}
+		return o.ArrivedAt.Time
+	}
+	return o.OrderID
 }
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"backend/internal/telemetry"
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// 注文のステータス変更の履歴 (order_events)
+// 追記のみで、更新・削除はしない
+type OrderEventRepository struct {
+	db DBTX
+}
+
+func NewOrderEventRepository(db DBTX) *OrderEventRepository {
+	return &OrderEventRepository{db: db}
+}
+
+// 履歴を追記する
+// ステータスの更新と同じトランザクションで呼ぶこと
+func (r *OrderEventRepository) Append(ctx context.Context, events []model.OrderEvent) (err error) {
+	ctx, span := startSpan(ctx, "OrderEventRepository.Append", attribute.Int("order_events.count", len(events)))
+	defer func() { telemetry.End(span, err) }()
+
+	if len(events) == 0 {
+		return nil
+	}
+	query := "INSERT INTO order_events (order_id, event_type, from_status, to_status, actor_type, actor_id, plan_id, occurred_at) VALUES "
+	placeholders := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*8)
+	for _, e := range events {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, e.OrderID, e.EventType, e.FromStatus, e.ToStatus, e.ActorType, e.ActorID, e.PlanID, e.OccurredAt)
+	}
+	_, err = r.db.ExecContext(ctx, query+strings.Join(placeholders, ","), args...)
+	return err
+}
+
+// 注文の履歴を古い順に取得
+func (r *OrderEventRepository) ListByOrder(ctx context.Context, orderID int64) (_ []model.OrderEvent, err error) {
+	ctx, span := startSpan(ctx, "OrderEventRepository.ListByOrder", attribute.Int64("order.id", orderID))
+	defer func() { telemetry.End(span, err) }()
+
+	var events []model.OrderEvent
+	query := `
+		SELECT event_id, order_id, event_type, from_status, to_status, actor_type, actor_id, plan_id, occurred_at
+		FROM order_events
+		WHERE order_id = ?
+		ORDER BY event_id`
+	if err := r.db.SelectContext(ctx, &events, query, orderID); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(events)))
+	return events, nil
+}
@@ -2,54 +2,112 @@ package repository
 
 import (
 	"backend/internal/model"
+	"backend/internal/telemetry"
 	"context"
+	"strings"
 )
 
 type DbProductRepository struct {
 	db DBTX
 }
 
+// 一覧取得のみのため、レプリカに振り分ける場合は読み取り用の接続を渡す
 func NewDbProductRepository(db DBTX) IProductRepository {
 	return &DbProductRepository{db: db}
 }
 
-// 商品一覧を全件取得し、アプリケーション側でページング処理を行う
-func (r *DbProductRepository) ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error) {
-	var products []model.Product
-	var total int
+// 並び替え可能な商品の列
+var productSortColumns = map[string]sortColumn{
+	"product_id": {expr: "product_id", kind: sortInt},
+	"name":       {expr: "name", kind: sortString},
+	"value":      {expr: "value", kind: sortInt},
+	"weight":     {expr: "weight", kind: sortInt},
+}
 
-	// 件数取得
-	countQuery := "SELECT COUNT(*) FROM products"
-	countArgs := []interface{}{}
-	whereClause := ""
+// 商品一覧を取得する
+// req.Cursorがあればキーセット、なければOFFSETでページングする
+func (r *DbProductRepository) ListProducts(ctx context.Context, userID int, req model.ListRequest) (_ []model.Product, _ model.PageInfo, err error) {
+	ctx, span := startSpan(ctx, "ProductRepository.ListProducts",
+		append(telemetry.ListAttributes(req.Page, req.PageSize, req.Search, req.SortField),
+			telemetry.AttrListCursor.Bool(req.Cursor != ""))...)
+	defer func() { telemetry.End(span, err) }()
+
+	var page model.PageInfo
+
+	column, ok := productSortColumns[req.SortField]
+	if !ok {
+		req.SortField, column = "product_id", productSortColumns["product_id"]
+	}
+	ks := keyset{
+		field:  req.SortField,
+		column: column,
+		desc:   strings.EqualFold(req.SortOrder, "desc"),
+		// 既存の並び順に合わせ、同じ値の商品は常にID昇順で並べる
+		idExpr: "product_id",
+	}
+
+	var conditions []string
+	var args []interface{}
 	if req.Search != "" {
-		whereClause = " WHERE (name LIKE ? OR description LIKE ?)"
+		conditions = append(conditions, "(name LIKE ? OR description LIKE ?)")
 		searchPattern := "%" + req.Search + "%"
-		countArgs = append(countArgs, searchPattern, searchPattern)
+		args = append(args, searchPattern, searchPattern)
 	}
-	err := r.db.GetContext(ctx, &total, countQuery+whereClause, countArgs...)
-	if err != nil {
-		return nil, 0, err
+
+	// 件数取得
+	if req.WantTotal() {
+		var total int
+		err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM products"+whereClause(conditions), args...)
+		if err != nil {
+			return nil, page, err
+		}
+		page.Total = &total
+		span.SetAttributes(telemetry.AttrResultTotal.Int(total))
 	}
 
 	// ページング取得
+	// 次のページの有無を判定するため、1件多く取得する
+	limitClause := " LIMIT ? OFFSET ?"
+	pageArgs := []interface{}{req.PageSize + 1, req.Offset}
+	if req.Cursor != "" {
+		cond, cursorArgs, err := ks.after(req.Cursor)
+		if err != nil {
+			return nil, page, err
+		}
+		conditions = append(conditions, cond)
+		args = append(args, cursorArgs...)
+		limitClause = " LIMIT ?"
+		pageArgs = pageArgs[:1]
+	}
 	baseQuery := `
 		SELECT product_id, name, value, weight, image, description
 		FROM products
-	`
-	args := []interface{}{}
-	if req.Search != "" {
-		baseQuery += whereClause
-		args = append(args, "%"+req.Search+"%", "%"+req.Search+"%")
-	}
-	baseQuery += " ORDER BY " + req.SortField + " " + req.SortOrder + " , product_id ASC"
-	baseQuery += " LIMIT ? OFFSET ?"
-	args = append(args, req.PageSize, req.Offset)
+	` + whereClause(conditions) + ks.orderBy() + limitClause
 
-	err = r.db.SelectContext(ctx, &products, baseQuery, args...)
+	var products []model.Product
+	err = r.db.SelectContext(ctx, &products, baseQuery, append(args, pageArgs...)...)
 	if err != nil {
-		return nil, 0, err
+		return nil, page, err
 	}
 
-	return products, total, nil
+	if len(products) > req.PageSize {
+		products = products[:req.PageSize]
+		last := products[len(products)-1]
+		page.NextCursor = ks.next(productSortValue(last, req.SortField), int64(last.ProductID))
+	}
+
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(products)))
+	return products, page, nil
+}
+
+func productSortValue(p model.Product, field string) any {
+	switch field {
+	case "name":
+		return p.Name
+	case "value":
+		return p.Value
+	case "weight":
+		return p.Weight
+	}
+	return p.ProductID
 }
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// レプリカの状態を通知できるDBTX (db.Replicaが実装する)
+type healthReporter interface {
+	Healthy() bool
+	ReportError(err error)
+}
+
+// 多少の遅延を許容できる読み取りクエリをレプリカに振り分けるDBTX
+//
+// レプリカが不健全な間はプライマリで実行する。レプリカでのクエリが接続エラーで失敗した場合も
+// レプリカを不健全として報告し、同じクエリをプライマリで実行し直す。
+// 書き込みは常にプライマリで実行する
+type replicaReader struct {
+	primary DBTX
+	replica DBTX
+}
+
+func newReplicaReader(primary, replica DBTX) *replicaReader {
+	return &replicaReader{primary: primary, replica: replica}
+}
+
+func (r *replicaReader) useReplica() bool {
+	h, ok := r.replica.(healthReporter)
+	return !ok || h.Healthy()
+}
+
+// レプリカでの失敗をプライマリで再実行すべきか
+// SQL自体のエラー(MySQLError)や結果なし、呼び出し側のキャンセルはプライマリでも同じ結果になるため再実行しない
+func (r *replicaReader) fallback(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return false
+	}
+	if h, ok := r.replica.(healthReporter); ok {
+		h.ReportError(err)
+	}
+	return true
+}
+
+func (r *replicaReader) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if r.useReplica() {
+		err := r.replica.GetContext(ctx, dest, query, args...)
+		if !r.fallback(ctx, err) {
+			return err
+		}
+	}
+	return r.primary.GetContext(ctx, dest, query, args...)
+}
+
+func (r *replicaReader) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if r.useReplica() {
+		err := r.replica.SelectContext(ctx, dest, query, args...)
+		if !r.fallback(ctx, err) {
+			return err
+		}
+		// 途中まで読み込んだ行が残らないよう、宛先をゼロ値に戻してから再実行する
+		if v := reflect.ValueOf(dest); v.Kind() == reflect.Pointer && !v.IsNil() {
+			v.Elem().SetZero()
+		}
+	}
+	return r.primary.SelectContext(ctx, dest, query, args...)
+}
+
+func (r *replicaReader) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r *replicaReader) Rebind(query string) string {
+	return r.primary.Rebind(query)
+}
@@ -0,0 +1,60 @@
+// リポジトリ・サービスのテストで使うスタブ
+//
+// DBはMySQLなしでリポジトリを動かすためのDBTXで、書き込みは常に成功し、読み取りは結果なしを返す。
+// *sqlx.DBではないため、Store.ExecTxはトランザクションを開始せずにそのままfnを実行する。
+//
+//	db := &repositorytest.DB{LastInsertID: 100}
+//	store := repository.NewStore(db, nil)
+//	store.ProductRepo = &repositorytest.ProductRepo{Products: products}
+package repositorytest
+
+import (
+	"context"
+	"database/sql"
+
+	"backend/internal/model"
+)
+
+type DB struct {
+	// ExecContextの結果のLastInsertId
+	LastInsertID int64
+	// 実行した書き込みのSQL
+	Execs []string
+}
+
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return sql.ErrNoRows
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db.Execs = append(db.Execs, query)
+	return result(db.LastInsertID), nil
+}
+
+func (db *DB) Rebind(query string) string { return query }
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) { return int64(r), nil }
+func (r result) RowsAffected() (int64, error) { return 1, nil }
+
+// 固定の商品を返すIProductRepository
+type ProductRepo struct {
+	Products []model.Product
+	Err      error
+	// ListProductsが呼ばれた回数
+	Calls int
+}
+
+func (r *ProductRepo) ListProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, model.PageInfo, error) {
+	r.Calls++
+	if r.Err != nil {
+		return nil, model.PageInfo{}, r.Err
+	}
+	total := len(r.Products)
+	return r.Products, model.PageInfo{Total: &total}, nil
+}
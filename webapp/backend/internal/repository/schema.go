@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"backend/internal/telemetry"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// schema_migrationsテーブルが存在しない(マイグレーションが記録されていない)ことを表すエラー
+var ErrNoSchemaVersion = errors.New("schema version not recorded")
+
+type SchemaRepository struct {
+	db DBTX
+}
+
+func NewSchemaRepository(db DBTX) *SchemaRepository {
+	return &SchemaRepository{db: db}
+}
+
+// 適用済みの最新マイグレーションバージョンを取得
+func (r *SchemaRepository) CurrentVersion(ctx context.Context) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "SchemaRepository.CurrentVersion")
+	defer func() { telemetry.End(span, err) }()
+
+	var version *int64
+	err = r.db.GetContext(ctx, &version, "SELECT MAX(version) FROM schema_migrations")
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		// 1146: Table doesn't exist
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 {
+			return 0, ErrNoSchemaVersion
+		}
+		return 0, err
+	}
+	if version == nil {
+		return 0, ErrNoSchemaVersion
+	}
+	return *version, nil
+}
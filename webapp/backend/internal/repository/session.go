@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"backend/internal/model"
+	"backend/internal/telemetry"
 	"context"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 )
 
 type SessionRepository struct {
@@ -16,7 +19,10 @@ func NewSessionRepository(db DBTX) *SessionRepository {
 }
 
 // セッションを作成し、セッションIDと有効期限を返す
-func (r *SessionRepository) Create(ctx context.Context, userBusinessID int, duration time.Duration) (string, time.Time, error) {
+func (r *SessionRepository) Create(ctx context.Context, userBusinessID int, duration time.Duration) (_ string, _ time.Time, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.Create", telemetry.AttrUserID.Int(userBusinessID))
+	defer func() { telemetry.End(span, err) }()
+
 	sessionUUID, err := uuid.NewRandom()
 	if err != nil {
 		return "", time.Time{}, err
@@ -32,31 +38,62 @@ func (r *SessionRepository) Create(ctx context.Context, userBusinessID int, dura
 	return sessionIDStr, expiresAt, nil
 }
 
-// セッションIDからユーザーIDを取得
-func (r *SessionRepository) FindUserBySessionID(ctx context.Context, sessionID string) (int, error) {
-	var userID int
+// セッションIDからユーザー情報(ID・ユーザー名・ロール)を取得
+func (r *SessionRepository) FindUserBySessionID(ctx context.Context, sessionID string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.FindUserBySessionID")
+	defer func() { telemetry.End(span, err) }()
+
+	var user model.User
 	query := `
 		SELECT 
-			u.user_id
+			u.user_id, u.user_name, u.role
 		FROM users u
 		JOIN user_sessions s ON u.user_id = s.user_id
 		WHERE s.session_uuid = ? AND s.expires_at > ?`
-	err := r.db.GetContext(ctx, &userID, query, sessionID, time.Now())
+	err = r.db.GetContext(ctx, &user, query, sessionID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// 指定セッション以外のユーザーのセッションを全て削除し、削除したセッションIDを返す
+// パスワード変更時に他の端末のセッションを無効化するために使用
+func (r *SessionRepository) DeleteByUserExcept(ctx context.Context, userID int, keepSessionID string) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.DeleteByUserExcept", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	var sessionIDs []string
+	query := "SELECT session_uuid FROM user_sessions WHERE user_id = ? AND session_uuid <> ?"
+	if err := r.db.SelectContext(ctx, &sessionIDs, query, userID, keepSessionID); err != nil {
+		return nil, err
+	}
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In("DELETE FROM user_sessions WHERE session_uuid IN (?)", sessionIDs)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(query), args...); err != nil {
+		return nil, err
 	}
-	return userID, nil
+	return sessionIDs, nil
 }
 
 // GetSessionInfo はセッションIDに基づいてセッション情報を取得する
 type SessionInfo struct {
-	UserID    int
-	ExpiresAt time.Time
+	UserID    int       `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
 }
 
-func (r *SessionRepository) GetSessionInfo(ctx context.Context, sessionID string) (*SessionInfo, error) {
+func (r *SessionRepository) GetSessionInfo(ctx context.Context, sessionID string) (_ *SessionInfo, err error) {
+	ctx, span := startSpan(ctx, "SessionRepository.GetSessionInfo")
+	defer func() { telemetry.End(span, err) }()
+
 	var info SessionInfo
 	query := `SELECT user_id, expires_at FROM user_sessions WHERE session_uuid = ?`
-	err := r.db.GetContext(ctx, &info, query, sessionID)
+	err = r.db.GetContext(ctx, &info, query, sessionID)
 	return &info, err
 }
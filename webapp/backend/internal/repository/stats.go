@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"backend/internal/telemetry"
+	"context"
+	"time"
+)
+
+// 配送統計の集計
+// 多少の遅延は許容できるため、全てreader(レプリカがあればレプリカ)で実行する。
+// 集計期間はいずれも [from, to)
+type StatsRepository struct {
+	reader DBTX
+}
+
+func NewStatsRepository(reader DBTX) *StatsRepository {
+	return &StatsRepository{reader: reader}
+}
+
+// 期間内に作成された注文の、現在のステータスごとの件数
+func (r *StatsRepository) CountByStatus(ctx context.Context, from, to time.Time) (_ map[string]int, err error) {
+	ctx, span := startSpan(ctx, "StatsRepository.CountByStatus")
+	defer func() { telemetry.End(span, err) }()
+
+	var rows []struct {
+		Status string `db:"shipped_status"`
+		Count  int    `db:"cnt"`
+	}
+	query := `
+		SELECT shipped_status, COUNT(*) AS cnt
+		FROM orders
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY shipped_status`
+	if err := r.reader.SelectContext(ctx, &rows, query, from, to); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// 期間内に到着した注文の、作成から到着までの秒数の平均・中央値・95パーセンタイル
+// パーセンタイルはnearest-rank法 (昇順でceil(p*件数)番目の値)
+func (r *StatsRepository) DeliveryTime(ctx context.Context, from, to time.Time) (_ model.DeliveryTimeStats, err error) {
+	ctx, span := startSpan(ctx, "StatsRepository.DeliveryTime")
+	defer func() { telemetry.End(span, err) }()
+
+	var stats model.DeliveryTimeStats
+	query := `
+		SELECT
+			COUNT(*) AS delivered,
+			AVG(secs) AS avg_seconds,
+			MAX(CASE WHEN rn = CEIL(0.5 * cnt) THEN secs END) AS median_seconds,
+			MAX(CASE WHEN rn = CEIL(0.95 * cnt) THEN secs END) AS p95_seconds
+		FROM (
+			SELECT
+				TIMESTAMPDIFF(SECOND, created_at, arrived_at) AS secs,
+				ROW_NUMBER() OVER (ORDER BY TIMESTAMPDIFF(SECOND, created_at, arrived_at)) AS rn,
+				COUNT(*) OVER () AS cnt
+			FROM orders
+			WHERE arrived_at >= ? AND arrived_at < ?
+		) t`
+	err = r.reader.GetContext(ctx, &stats, query, from, to)
+	return stats, err
+}
+
+// 期間内に作成された注文数の多い商品を最大limit件
+func (r *StatsRepository) ProductVolumes(ctx context.Context, from, to time.Time, limit int) (_ []model.ProductVolume, err error) {
+	ctx, span := startSpan(ctx, "StatsRepository.ProductVolumes")
+	defer func() { telemetry.End(span, err) }()
+
+	var volumes []model.ProductVolume
+	query := `
+		SELECT v.product_id, p.name, v.orders, v.delivered
+		FROM (
+			SELECT product_id, COUNT(*) AS orders, SUM(shipped_status = 'completed') AS delivered
+			FROM orders
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY product_id
+			ORDER BY orders DESC, product_id
+			LIMIT ?
+		) v
+		JOIN products p ON p.product_id = v.product_id
+		ORDER BY v.orders DESC, v.product_id`
+	if err := r.reader.SelectContext(ctx, &volumes, query, from, to, limit); err != nil {
+		return nil, err
+	}
+	return volumes, nil
+}
+
+// 期間内のロボットごとの配送計画数・積載量と、到着を報告した注文数
+func (r *StatsRepository) RobotThroughput(ctx context.Context, from, to time.Time) (_ []model.RobotThroughput, err error) {
+	ctx, span := startSpan(ctx, "StatsRepository.RobotThroughput")
+	defer func() { telemetry.End(span, err) }()
+
+	var robots []model.RobotThroughput
+	// 計画と到着の報告はどちらか一方しかないロボットもあるため、両方を集計してから合わせる
+	query := `
+		SELECT
+			robot_id,
+			SUM(plans) AS plans,
+			SUM(orders) AS orders,
+			SUM(delivered) AS delivered,
+			SUM(total_weight) AS total_weight,
+			SUM(total_capacity) AS total_capacity
+		FROM (
+			SELECT robot_id, COUNT(*) AS plans, SUM(order_count) AS orders, 0 AS delivered,
+			       SUM(total_weight) AS total_weight, SUM(capacity) AS total_capacity
+			FROM delivery_plans
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY robot_id
+			UNION ALL
+			SELECT actor_id, 0, 0, COUNT(*), 0, 0
+			FROM order_events
+			WHERE event_type = ? AND occurred_at >= ? AND occurred_at < ? AND actor_type = ?
+			GROUP BY actor_id
+		) t
+		GROUP BY robot_id
+		ORDER BY robot_id`
+	err = r.reader.SelectContext(ctx, &robots, query,
+		from, to, model.OrderEventArrived, from, to, model.OrderActorRobot)
+	if err != nil {
+		return nil, err
+	}
+	return robots, nil
+}
@@ -2,48 +2,115 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"backend/internal/telemetry"
 
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Store struct {
-	db          DBTX
-	UserRepo    *UserRepository
-	SessionRepo *SessionRepository
-	ProductRepo IProductRepository
-	OrderRepo   *OrderRepository
+	db DBTX
+	// 読み取り専用レプリカ (なければnil)
+	replica        DBTX
+	UserRepo       *UserRepository
+	SessionRepo    *SessionRepository
+	ProductRepo    IProductRepository
+	OrderRepo      *OrderRepository
+	OrderEventRepo *OrderEventRepository
+	PlanRepo       *DeliveryPlanRepository
+	StatsRepo      *StatsRepository
+	TokenRepo      *APITokenRepository
+	SchemaRepo     *SchemaRepository
+	WebhookRepo    *WebhookRepository
 }
 
-func NewStore(db DBTX) *Store {
+// replicaを指定した場合、多少の遅延を許容できる読み取り(商品・注文一覧、統計)を
+// レプリカに振り分ける。ExecTx内ではトランザクションの一貫性のため全てプライマリで実行する
+// セッションはログアウトやロール変更が遅れて反映されないよう、常にプライマリから取得する
+func NewStore(db DBTX, replica DBTX) *Store {
+	reader := db
+	if replica != nil {
+		reader = newReplicaReader(db, replica)
+	}
 
-	dbProductRepo := NewDbProductRepository(db)
+	dbProductRepo := NewDbProductRepository(reader)
 
 	// 2. キャッシュ機能を持つリポジトリでラップします (この行も抜けていました)
 	cachedProductRepo := NewCachingProductRepository(dbProductRepo) 
 
 
 	return &Store{
-		db:          db,
-		UserRepo:    NewUserRepository(db),
-		SessionRepo: NewSessionRepository(db),
-		ProductRepo: cachedProductRepo,
-		OrderRepo:   NewOrderRepository(db),
+		db:             db,
+		replica:        replica,
+		UserRepo:       NewUserRepository(db),
+		SessionRepo:    NewSessionRepository(db),
+		ProductRepo:    cachedProductRepo,
+		OrderRepo:      NewOrderRepository(db, reader),
+		OrderEventRepo: NewOrderEventRepository(db),
+		PlanRepo:       NewDeliveryPlanRepository(db),
+		StatsRepo:      NewStatsRepository(reader),
+		TokenRepo:      NewAPITokenRepository(db),
+		SchemaRepo:     NewSchemaRepository(db),
+		WebhookRepo:    NewWebhookRepository(db),
 	}
 }
 
-func (s *Store) ExecTx(ctx context.Context, fn func(txStore *Store) error) error {
+// fnをトランザクション内で実行する
+//
+// デッドロック(1213)・ロック待ちタイムアウト(1205)で失敗した場合は、ジッター付きの待ち時間を
+// 挟んでfnを最初からやり直す。fnは複数回呼ばれうるため、トランザクション外への副作用は
+// 戻り値の代入程度にとどめること。
+// 既にトランザクション内のStoreで呼んだ場合は、外側のトランザクションでそのままfnを実行する
+func (s *Store) ExecTx(ctx context.Context, fn func(txStore *Store) error, opts ...TxOption) (err error) {
+	cfg := newTxConfig(opts)
+	ctx, span := startSpan(ctx, "Store.ExecTx",
+		telemetry.AttrTxReadOnly.Bool(cfg.opts.ReadOnly),
+		telemetry.AttrTxIsolation.String(cfg.opts.Isolation.String()),
+	)
+	defer func() { telemetry.End(span, err) }()
+
 	db, ok := s.db.(*sqlx.DB)
 	if !ok {
 		return fn(s)
 	}
 
-	tx, err := db.BeginTxx(ctx, nil)
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(telemetry.AttrTxAttempts.Int(attempt))
+		err = s.execTxOnce(ctx, db, &cfg.opts, fn)
+		reason, retryable := retryableTxError(err)
+		if !retryable {
+			return err
+		}
+		if attempt >= cfg.maxAttempts {
+			return fmt.Errorf("transaction failed after %d attempts: %w", attempt, err)
+		}
+
+		backoff := txBackoff(attempt)
+		span.AddEvent(telemetry.EventTxRetry, trace.WithAttributes(
+			telemetry.AttrTxAttempts.Int(attempt),
+			telemetry.AttrTxRetryReason.String(reason),
+			telemetry.AttrTxBackoffMS.Int64(backoff.Milliseconds()),
+		))
+		slog.WarnContext(ctx, "retrying transaction",
+			slog.Int("attempt", attempt), slog.String("reason", reason), slog.Duration("backoff", backoff))
+		if err := sleepCtx(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Store) execTxOnce(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(txStore *Store) error) error {
+	tx, err := db.BeginTxx(ctx, opts)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	txStore := NewStore(tx)
+	txStore := NewStore(tx, nil)
 	if err := fn(txStore); err != nil {
 		return err
 	}
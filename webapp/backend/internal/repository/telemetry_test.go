@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"backend/internal/model"
+	"backend/internal/repository/repositorytest"
+	"backend/internal/telemetry"
+	"backend/internal/telemetry/telemetrytest"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestCachingProductRepositorySpans(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	next := &repositorytest.ProductRepo{Products: []model.Product{{ProductID: 1, Name: "mug"}}}
+	repo := NewCachingProductRepository(next)
+	req := model.ListRequest{Page: 1, PageSize: 20, SortField: "product_id", SortOrder: "asc"}
+
+	if _, _, err := repo.ListProducts(context.Background(), 1, req); err != nil {
+		t.Fatalf("ListProducts: %v", err)
+	}
+	if err := rec.Assert("CachingProductRepository.ListProducts",
+		telemetrytest.HasBool(telemetry.AttrCacheHit, false),
+		telemetrytest.HasString(telemetry.AttrCacheName, "product_local"),
+	); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, err := repo.ListProducts(context.Background(), 1, req); err != nil {
+		t.Fatalf("ListProducts: %v", err)
+	}
+	if err := rec.Assert("CachingProductRepository.ListProducts",
+		telemetrytest.HasBool(telemetry.AttrCacheHit, true),
+		telemetrytest.HasStatus(codes.Unset),
+	); err != nil {
+		t.Error(err)
+	}
+	if next.Calls != 1 {
+		t.Errorf("next repository called %d times, want 1", next.Calls)
+	}
+}
+
+func TestCachingProductRepositoryErrorSpan(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	repo := NewCachingProductRepository(&repositorytest.ProductRepo{Err: errors.New("connection refused")})
+	if _, _, err := repo.ListProducts(context.Background(), 1, model.ListRequest{}); err == nil {
+		t.Fatal("ListProducts returned no error")
+	}
+	if err := rec.Assert("CachingProductRepository.ListProducts",
+		telemetrytest.HasBool(telemetry.AttrCacheHit, false),
+		telemetrytest.HasStatus(codes.Error),
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrderRepositoryCreateBulkSpan(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	db := &repositorytest.DB{LastInsertID: 100}
+	repo := NewOrderRepository(db, db)
+	ids, err := repo.CreateBulk(context.Background(), []model.Order{
+		{UserID: 1, ProductID: 10}, {UserID: 1, ProductID: 10}, {UserID: 1, ProductID: 11},
+	})
+	if err != nil {
+		t.Fatalf("CreateBulk: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "100" || ids[2] != "102" {
+		t.Errorf("CreateBulk = %v, want [100 101 102]", ids)
+	}
+	if err := rec.Assert("OrderRepository.CreateBulk",
+		telemetrytest.HasInt(telemetry.AttrOrdersCreated, 3),
+		telemetrytest.HasStatus(codes.Unset),
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserRepositoryFindByIDSpan(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	repo := NewUserRepository(&repositorytest.DB{})
+	if _, err := repo.FindByID(context.Background(), 42); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("FindByID error = %v, want sql.ErrNoRows", err)
+	}
+	if err := rec.Assert("UserRepository.FindByID",
+		telemetrytest.HasInt(telemetry.AttrUserID, 42),
+		// 見つからないだけの場合はエラーにしない
+		telemetrytest.HasStatus(codes.Unset),
+	); err != nil {
+		t.Error(err)
+	}
+}
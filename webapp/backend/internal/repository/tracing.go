@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// リポジトリメソッドのスパンを開始する
+// SQLそのものはotelsqlが子スパンとして記録するため、ここでは業務上の属性のみを付与する。
+// TracerProviderの差し替え(telemetrytest等)に追従できるよう、Tracerは毎回取得する
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("repository").Start(ctx, name, trace.WithAttributes(attrs...))
+}
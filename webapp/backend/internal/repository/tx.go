@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ExecTxのデフォルトの試行回数 (初回を含む)
+const defaultTxMaxAttempts = 3
+
+// 再試行までの待ち時間の基準値と上限
+// 試行ごとに基準値を倍にし、0から上限までの間でランダムに待つ (フルジッター)
+const (
+	txBackoffBase = 20 * time.Millisecond
+	txBackoffMax  = 500 * time.Millisecond
+)
+
+// 再試行すれば成功しうるMySQLのエラー番号
+var retryableTxErrors = map[uint16]string{
+	1205: "lock_wait_timeout",
+	1213: "deadlock",
+}
+
+type txConfig struct {
+	opts        sql.TxOptions
+	maxAttempts int
+}
+
+// ExecTxのオプション
+type TxOption func(*txConfig)
+
+// トランザクション分離レベルを指定する (デフォルトはサーバーの設定。MySQLではREPEATABLE READ)
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(c *txConfig) { c.opts.Isolation = level }
+}
+
+// 読み取り専用のトランザクションにする
+func ReadOnly() TxOption {
+	return func(c *txConfig) { c.opts.ReadOnly = true }
+}
+
+// デッドロック・ロック待ちタイムアウト時の試行回数 (初回を含む) を指定する
+// 1を指定すると再試行しない
+func WithMaxAttempts(n int) TxOption {
+	return func(c *txConfig) {
+		if n > 0 {
+			c.maxAttempts = n
+		}
+	}
+}
+
+func newTxConfig(opts []TxOption) txConfig {
+	cfg := txConfig{maxAttempts: defaultTxMaxAttempts}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// トランザクションをやり直せば成功しうるエラーか
+// MySQLはデッドロック時にトランザクション全体をロールバックするため、文単位ではなく最初からやり直す
+func retryableTxError(err error) (string, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return "", false
+	}
+	reason, ok := retryableTxErrors[mysqlErr.Number]
+	return reason, ok
+}
+
+// attempt回目(1始まり)の失敗後に待つ時間
+func txBackoff(attempt int) time.Duration {
+	d := txBackoffBase << (attempt - 1)
+	if d <= 0 || d > txBackoffMax {
+		d = txBackoffMax
+	}
+	return rand.N(d)
+}
+
+// ctxが終了するまでdだけ待つ
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
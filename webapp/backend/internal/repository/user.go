@@ -6,8 +6,14 @@ import (
 	"errors"
 
 	"backend/internal/model"
+	"backend/internal/telemetry"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// 一意制約違反(MySQL 1062)を表すエラー
+var ErrDuplicateEntry = errors.New("duplicate entry")
+
 type UserRepository struct {
 	db DBTX
 }
@@ -18,11 +24,14 @@ func NewUserRepository(db DBTX) *UserRepository {
 
 // ユーザー名からユーザー情報を取得
 // ログイン時に使用
-func (r *UserRepository) FindByUserName(ctx context.Context, userName string) (*model.User, error) {
+func (r *UserRepository) FindByUserName(ctx context.Context, userName string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "UserRepository.FindByUserName")
+	defer func() { telemetry.End(span, err) }()
+
 	var user model.User
-	query := "SELECT user_id, password_hash, user_name FROM users WHERE user_name = ?"
+	query := "SELECT user_id, password_hash, user_name, role FROM users WHERE user_name = ?"
 
-	err := r.db.GetContext(ctx, &user, query, userName)
+	err = r.db.GetContext(ctx, &user, query, userName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, err
@@ -31,3 +40,63 @@ func (r *UserRepository) FindByUserName(ctx context.Context, userName string) (*
 	}
 	return &user, nil
 }
+
+// ユーザーIDからユーザー情報を取得
+func (r *UserRepository) FindByID(ctx context.Context, userID int) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "UserRepository.FindByID", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	var user model.User
+	query := "SELECT user_id, password_hash, user_name, role FROM users WHERE user_id = ?"
+
+	if err := r.db.GetContext(ctx, &user, query, userID); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ユーザーを作成し、生成されたユーザーIDを返す
+// ユーザー名が重複している場合はErrDuplicateEntryを返す
+func (r *UserRepository) Create(ctx context.Context, user *model.User) (_ int, err error) {
+	ctx, span := startSpan(ctx, "UserRepository.Create")
+	defer func() { telemetry.End(span, err) }()
+
+	query := "INSERT INTO users (password_hash, user_name, role) VALUES (?, ?, ?)"
+	result, err := r.db.ExecContext(ctx, query, user.PasswordHash, user.UserName, user.Role)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicateEntry
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// パスワードハッシュを更新
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) (err error) {
+	ctx, span := startSpan(ctx, "UserRepository.UpdatePasswordHash", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	query := "UPDATE users SET password_hash = ? WHERE user_id = ?"
+	_, err = r.db.ExecContext(ctx, query, passwordHash, userID)
+	return err
+}
+
+// ロールを更新
+func (r *UserRepository) UpdateRole(ctx context.Context, userID int, role string) (err error) {
+	ctx, span := startSpan(ctx, "UserRepository.UpdateRole", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	query := "UPDATE users SET role = ? WHERE user_id = ?"
+	_, err = r.db.ExecContext(ctx, query, role, userID)
+	return err
+}
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"backend/internal/telemetry"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type WebhookRepository struct {
+	db DBTX
+}
+
+func NewWebhookRepository(db DBTX) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// Webhookを保存し、生成されたIDを返す
+func (r *WebhookRepository) Create(ctx context.Context, webhook *model.Webhook) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.Create", telemetry.AttrUserID.Int(webhook.UserID))
+	defer func() { telemetry.End(span, err) }()
+
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, event_types, active, created_at)
+		VALUES (?, ?, ?, ?, TRUE, ?)`
+	result, err := r.db.ExecContext(ctx, query,
+		webhook.UserID, webhook.URL, webhook.Secret, strings.Join(webhook.EventTypes, " "), webhook.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ユーザーのWebhook一覧を取得
+func (r *WebhookRepository) ListByUser(ctx context.Context, userID int) (_ []model.Webhook, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.ListByUser", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	var webhooks []model.Webhook
+	query := `
+		SELECT webhook_id, user_id, url, event_types, active, created_at
+		FROM webhooks
+		WHERE user_id = ?
+		ORDER BY webhook_id DESC`
+	if err := r.db.SelectContext(ctx, &webhooks, query, userID); err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].EventTypes = strings.Fields(webhooks[i].EventTypesRaw)
+	}
+	return webhooks, nil
+}
+
+// ユーザーのWebhookを1件取得
+// 存在しない、または他人のWebhookの場合はsql.ErrNoRowsを返す
+func (r *WebhookRepository) Get(ctx context.Context, userID int, webhookID int64) (_ *model.Webhook, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.Get", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	var webhook model.Webhook
+	query := `
+		SELECT webhook_id, user_id, url, event_types, active, created_at
+		FROM webhooks
+		WHERE webhook_id = ? AND user_id = ?`
+	if err := r.db.GetContext(ctx, &webhook, query, webhookID, userID); err != nil {
+		return nil, err
+	}
+	webhook.EventTypes = strings.Fields(webhook.EventTypesRaw)
+	return &webhook, nil
+}
+
+// ユーザーのWebhook数
+func (r *WebhookRepository) CountByUser(ctx context.Context, userID int) (_ int, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.CountByUser", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	var count int
+	err = r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM webhooks WHERE user_id = ?", userID)
+	return count, err
+}
+
+// Webhookを削除する (送信履歴も削除される)
+// 対象が存在しない、または他人のWebhookの場合はfalseを返す
+func (r *WebhookRepository) Delete(ctx context.Context, userID int, webhookID int64) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.Delete", telemetry.AttrUserID.Int(userID))
+	defer func() { telemetry.End(span, err) }()
+
+	result, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE webhook_id = ? AND user_id = ?", webhookID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// 注文と、その注文者の有効なWebhookの組
+type WebhookTarget struct {
+	WebhookID     int64        `db:"webhook_id"`
+	EventTypesRaw string       `db:"event_types"`
+	OrderID       int64        `db:"order_id"`
+	ProductID     int          `db:"product_id"`
+	ShippedStatus string       `db:"shipped_status"`
+	CreatedAt     time.Time    `db:"created_at"`
+	ArrivedAt     sql.NullTime `db:"arrived_at"`
+}
+
+// eventTypeを購読しているか
+func (t WebhookTarget) Subscribes(eventType string) bool {
+	for _, e := range strings.Fields(t.EventTypesRaw) {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// 注文ごとに、注文者の有効なWebhookを取得する
+// 注文の更新と同じトランザクションで呼び、更新後の注文の状態を送信内容に使う
+func (r *WebhookRepository) FindTargets(ctx context.Context, orderIDs []int64) (_ []WebhookTarget, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.FindTargets", telemetry.AttrOrdersUpdated.Int(len(orderIDs)))
+	defer func() { telemetry.End(span, err) }()
+
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+	query, args, err := sqlx.In(`
+		SELECT w.webhook_id, w.event_types, o.order_id, o.product_id, o.shipped_status, o.created_at, o.arrived_at
+		FROM orders o
+		JOIN webhooks w ON w.user_id = o.user_id AND w.active = TRUE
+		WHERE o.order_id IN (?)`, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	var targets []WebhookTarget
+	if err := r.db.SelectContext(ctx, &targets, r.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(targets)))
+	return targets, nil
+}
+
+// 送信待ちのイベントをアウトボックスに追加する
+func (r *WebhookRepository) Enqueue(ctx context.Context, deliveries []model.WebhookDelivery) (err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.Enqueue", attribute.Int("webhook.deliveries", len(deliveries)))
+	defer func() { telemetry.End(span, err) }()
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	query := "INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at) VALUES "
+	placeholders := make([]string, 0, len(deliveries))
+	args := make([]interface{}, 0, len(deliveries)*7)
+	for _, d := range deliveries {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, 0, ?, ?)")
+		args = append(args, d.WebhookID, d.EventID, d.EventType, string(d.Payload), model.WebhookDeliveryPending, d.NextAttemptAt, d.CreatedAt)
+	}
+	_, err = r.db.ExecContext(ctx, query+strings.Join(placeholders, ","), args...)
+	return err
+}
+
+// 送信先の情報を含む送信待ちのイベント
+type DueDelivery struct {
+	model.WebhookDelivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+// 送信時刻を過ぎたイベントを最大limit件取得し、leaseUntilまで他のワーカーに取得されないようにする
+// 他のワーカーがロックしている行は読み飛ばすため、トランザクション内で呼ぶこと
+func (r *WebhookRepository) ClaimDue(ctx context.Context, now time.Time, limit int, leaseUntil time.Time) (_ []DueDelivery, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.ClaimDue")
+	defer func() { telemetry.End(span, err) }()
+
+	var due []DueDelivery
+	query := `
+		SELECT d.delivery_id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		       d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.webhook_id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at
+		LIMIT ?
+		FOR UPDATE OF d SKIP LOCKED`
+	if err := r.db.SelectContext(ctx, &due, query, model.WebhookDeliveryPending, now, limit); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(due)))
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(due))
+	for i, d := range due {
+		ids[i] = d.DeliveryID
+	}
+	update, args, err := sqlx.In("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE delivery_id IN (?)", leaseUntil, ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(update), args...); err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// 送信に成功したことを記録する
+func (r *WebhookRepository) MarkSucceeded(ctx context.Context, deliveryID int64, attempts, statusCode int, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.MarkSucceeded")
+	defer func() { telemetry.End(span, err) }()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, last_status_code = ?, last_error = NULL, delivered_at = ?
+		WHERE delivery_id = ?`
+	_, err = r.db.ExecContext(ctx, query, model.WebhookDeliverySucceeded, attempts, statusCode, at, deliveryID)
+	return err
+}
+
+// 送信に失敗したことを記録する
+// deadの場合はこれ以上送信しない。statusCodeが0の場合は応答がなかったものとして記録する
+func (r *WebhookRepository) MarkFailed(ctx context.Context, deliveryID int64, attempts, statusCode int, message string, nextAttemptAt time.Time, dead bool) (err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.MarkFailed")
+	defer func() { telemetry.End(span, err) }()
+
+	status := model.WebhookDeliveryPending
+	if dead {
+		status = model.WebhookDeliveryDead
+	}
+	code := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = ?
+		WHERE delivery_id = ?`
+	_, err = r.db.ExecContext(ctx, query, status, attempts, code, message, nextAttemptAt, deliveryID)
+	return err
+}
+
+// Webhookの送信履歴を新しい順に取得
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID int64, limit int) (_ []model.WebhookDelivery, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.ListDeliveries", attribute.Int64("webhook.id", webhookID))
+	defer func() { telemetry.End(span, err) }()
+
+	var deliveries []model.WebhookDelivery
+	query := `
+		SELECT delivery_id, webhook_id, event_id, event_type, payload, status, attempts,
+		       next_attempt_at, last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY delivery_id DESC
+		LIMIT ?`
+	if err := r.db.SelectContext(ctx, &deliveries, query, webhookID, limit); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(telemetry.AttrResultCount.Int(len(deliveries)))
+	return deliveries, nil
+}
+
+// 再試行の上限に達したイベントを送信待ちに戻す
+// 対象が存在しない、または送信待ちに戻せない状態の場合はfalseを返す
+func (r *WebhookRepository) Redeliver(ctx context.Context, webhookID, deliveryID int64, now time.Time) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "WebhookRepository.Redeliver", attribute.Int64("webhook.id", webhookID))
+	defer func() { telemetry.End(span, err) }()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE delivery_id = ? AND webhook_id = ? AND status = ?`
+	result, err := r.db.ExecContext(ctx, query, model.WebhookDeliveryPending, now, deliveryID, webhookID, model.WebhookDeliveryDead)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -1,78 +1,230 @@
 package server
 
 import (
+	"backend/internal/apierror"
+	"backend/internal/config"
 	"backend/internal/db"
+	"backend/internal/events"
 	"backend/internal/handler"
+	"backend/internal/metrics"
 	"backend/internal/middleware"
+	"backend/internal/migration"
+	"backend/internal/model"
 	"backend/internal/repository"
 	"backend/internal/service"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
 	"github.com/riandyrn/otelchi"
 )
 
 type Server struct {
 	Router *chi.Mux
+
+	httpServer  *http.Server
+	dbConn      *sqlx.DB
+	replica     *db.Replica
+	redisClient redis.UniversalClient
+	logger      *slog.Logger
+
+	// falseの間はヘルスチェックが503を返す (シャットダウン中のドレイン用)
+	ready atomic.Bool
+	// ready=falseにしてから新規接続の受付を止めるまでの待ち時間
+	drainDelay time.Duration
+
+	// Webhookの送信ワーカーの停止用 (ワーカーを動かさない場合はnil)
+	stopWebhookDispatcher context.CancelFunc
+	webhookDispatcherDone chan struct{}
 }
 
-func NewServer() (*Server, *sqlx.DB, error) {
-	dbConn, err := db.InitDBConnection()
+func NewServer(cfg *config.Config, logger *slog.Logger) (*Server, error) {
+	dbConn, err := db.InitDBConnection(cfg.Database)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if err := prepareSchema(cfg.Migration, dbConn, logger); err != nil {
+		dbConn.Close()
+		return nil, err
+	}
+	replica, err := db.InitReplicaConnection(cfg.Database)
+	if err != nil {
+		dbConn.Close()
+		return nil, err
 	}
 	// Redisクライアントを初期化
-	redisClient, err := db.InitRedisClient()
+	redisClient, err := db.InitRedisClient(cfg.Redis)
 	if err != nil {
-		log.Printf("Warning: Redis connection failed, continuing without caching: %v", err)
+		logger.Warn("invalid redis configuration, continuing without caching", slog.Any("error", err))
 		// Redisなしでも続行可能
 	}
 
-	store := repository.NewStore(dbConn)
+	return NewServerWithConnections(cfg, logger, dbConn, replica, redisClient)
+}
 
-	authService := service.NewAuthService(store, redisClient)
-	orderService := service.NewOrderService(store)
-	productService := service.NewProductService(store, redisClient)
-	robotService := service.NewRobotService(store)
+// 接続済みのDB・レプリカ・Redisでサーバーを組み立てる
+// replicaとredisClientはnilでもよい。接続はサーバーが所有し、Shutdownで閉じる。
+// マイグレーションの適用・確認は行わないため、呼び出し側で済ませておくこと
+func NewServerWithConnections(cfg *config.Config, logger *slog.Logger, dbConn *sqlx.DB, replica *db.Replica, redisClient redis.UniversalClient) (*Server, error) {
+	// nilの*db.Replicaをそのまま渡すとnilでないインターフェースになるため分ける
+	var replicaDB repository.DBTX
+	if replica != nil {
+		replicaDB = replica
+	}
+	store := repository.NewStore(dbConn, replicaDB)
+
+	if cfg.Metrics.Enabled {
+		metrics.RegisterDBStats(dbConn.DB, "mysql")
+		if replica != nil {
+			metrics.RegisterDBStats(replica.DB.DB, "mysql_replica")
+		}
+		if cache, ok := store.ProductRepo.(*repository.CachingProductRepository); ok {
+			metrics.RegisterProductCacheSize(cache.Len)
+		}
+		metrics.RegisterOrderStatusCounts(store.OrderRepo.CountByStatus, cfg.Metrics.OrderCountsInterval)
+	}
 
-	authHandler := handler.NewAuthHandler(authService)
-	productHandler := handler.NewProductHandler(productService)
-	orderHandler := handler.NewOrderHandler(orderService)
-	robotHandler := handler.NewRobotHandler(robotService)
+	// 注文ステータスの変更通知 (Redisがなければプロセス内でのみ配信する)
+	bus := events.NewBus(redisClient, logger)
+	if cfg.Metrics.Enabled {
+		metrics.RegisterEventSubscribers(bus.Len)
+	}
 
-	userAuthMW := middleware.UserAuthMiddleware(store.SessionRepo, redisClient)
+	authService := service.NewAuthService(store, redisClient, logger)
+	orderService := service.NewOrderService(store, bus, service.ExportOptions{
+		MaxConcurrentPerUser: cfg.Export.MaxConcurrentPerUser,
+		BatchSize:            cfg.Export.BatchSize,
+	}, logger)
+	productService := service.NewProductService(store, redisClient, logger)
+	robotService := service.NewRobotService(store, bus, logger)
+	userService := service.NewUserService(store, redisClient, logger)
+	tokenService := service.NewAPITokenService(store, logger)
+	webhookService := service.NewWebhookService(store, logger)
+	statsService := service.NewStatsService(store, redisClient, service.StatsOptions{
+		CacheTTL:  cfg.Stats.CacheTTL,
+		MaxWindow: cfg.Stats.MaxWindow,
+	}, logger)
+	healthService := service.NewHealthService(dbConn, store, redisClient, logger)
 
-	robotAPIKey := os.Getenv("ROBOT_API_KEY")
-	if robotAPIKey == "" {
-		log.Println("Warning: ROBOT_API_KEY is not set. Using default key 'test-robot-key'")
-		robotAPIKey = "test-robot-key"
+	sameSite, err := cfg.Auth.SameSite()
+	if err != nil {
+		if replica != nil {
+			replica.Close()
+		}
+		dbConn.Close()
+		return nil, err
 	}
-	robotAuthMW := middleware.RobotAuthMiddleware(robotAPIKey)
+	cookieCfg := handler.CookieConfig{Secure: cfg.Auth.CookieSecure, SameSite: sameSite}
+
+	authHandler := handler.NewAuthHandler(authService, cookieCfg, logger)
+	productHandler := handler.NewProductHandler(productService, cfg.ImageDir, logger)
+	orderHandler := handler.NewOrderHandler(orderService, logger)
+	robotHandler := handler.NewRobotHandler(robotService, logger)
+	userHandler := handler.NewUserHandler(userService, logger)
+	tokenHandler := handler.NewAPITokenHandler(tokenService, logger)
+	webhookHandler := handler.NewWebhookHandler(webhookService, logger)
+	statsHandler := handler.NewStatsHandler(statsService, logger)
+
+	userAuthMW := middleware.UserAuthMiddleware(store.SessionRepo, store.TokenRepo, redisClient, logger)
+
+	if cfg.Auth.RobotAPIKey == config.DefaultRobotAPIKey {
+		logger.Warn("ROBOT_API_KEY is not set, using the default key")
+	}
+	robotAuthMW := middleware.RobotAuthMiddleware(cfg.Auth.RobotAPIKey)
+
+	csrfMW := middleware.CSRFMiddleware(cfg.Auth.CSRFTrustedOrigins)
 
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	if cfg.Metrics.Enabled {
+		r.Use(middleware.Metrics)
+	}
 	r.Use(otelchi.Middleware(
 		"backend-api",
 		otelchi.WithChiRoutes(r),
 		otelchi.WithFilter(func(req *http.Request) bool {
-			return req.URL.Path != "/api/health"
+			return !strings.HasPrefix(req.URL.Path, "/api/health") && req.URL.Path != "/metrics"
 		}),
 	))
-
-	r.Get("/api/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
+	r.Use(middleware.AccessLog(logger))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed)
 	})
 
 	s := &Server{
 		Router: r,
+		httpServer: &http.Server{
+			Addr:              ":" + cfg.Server.Port,
+			Handler:           r,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		},
+		dbConn:      dbConn,
+		replica:     replica,
+		redisClient: redisClient,
+		logger:      logger,
+		drainDelay:  cfg.Server.DrainDelay,
+	}
+	s.ready.Store(true)
+	// SSEの接続は終わらないため、シャットダウン開始時に購読を閉じてハンドラーを戻らせる
+	s.httpServer.RegisterOnShutdown(bus.Close)
+
+	if cfg.Webhook.DispatcherEnabled {
+		if cfg.Webhook.AllowPrivateTargets {
+			logger.Warn("webhook deliveries to private addresses are allowed")
+		}
+		dispatcher := service.NewWebhookDispatcher(store, service.WebhookDispatcherOptions{
+			PollInterval:        cfg.Webhook.PollInterval,
+			BatchSize:           cfg.Webhook.BatchSize,
+			Timeout:             cfg.Webhook.Timeout,
+			MaxAttempts:         cfg.Webhook.MaxAttempts,
+			AllowPrivateTargets: cfg.Webhook.AllowPrivateTargets,
+		}, logger)
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopWebhookDispatcher = cancel
+		s.webhookDispatcherDone = make(chan struct{})
+		go func() {
+			defer close(s.webhookDispatcherDone)
+			dispatcher.Run(ctx)
+		}()
 	}
 
-	s.setupRoutes(authHandler, productHandler, orderHandler, robotHandler, userAuthMW, robotAuthMW)
+	// nginxは/api/のみをバックエンドに転送するため、/metricsは外部に公開されない
+	if cfg.Metrics.Enabled {
+		r.Handle("/metrics", metrics.Handler())
+	}
+
+	healthHandler := handler.NewHealthHandler(healthService, s.ready.Load)
+	r.Get("/api/health/live", healthHandler.Live)
+	r.Get("/api/health/ready", healthHandler.Ready)
+
+	r.Get("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("draining"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
 
-	return s, dbConn, nil
+	s.setupRoutes(authHandler, productHandler, orderHandler, robotHandler, userHandler, tokenHandler, webhookHandler, statsHandler, userAuthMW, robotAuthMW, csrfMW)
+
+	return s, nil
 }
 
 func (s *Server) setupRoutes(
@@ -80,17 +232,60 @@ func (s *Server) setupRoutes(
 	productHandler *handler.ProductHandler,
 	orderHandler *handler.OrderHandler,
 	robotHandler *handler.RobotHandler,
+	userHandler *handler.UserHandler,
+	tokenHandler *handler.APITokenHandler,
+	webhookHandler *handler.WebhookHandler,
+	statsHandler *handler.StatsHandler,
 	userAuthMW func(http.Handler) http.Handler,
 	robotAuthMW func(http.Handler) http.Handler,
+	csrfMW func(http.Handler) http.Handler,
 ) {
 	s.Router.Post("/api/login", authHandler.Login)
 
 	s.Router.Route("/api/v1", func(r chi.Router) {
 		r.Use(userAuthMW)
-		r.Post("/product", productHandler.List)
-		r.Post("/product/post", productHandler.CreateOrders)
-		r.Post("/orders", orderHandler.List)
-		r.Get("/image", productHandler.GetImage)
+		r.With(middleware.RequireScope(model.ScopeProductsRead)).Post("/product", productHandler.List)
+		r.With(middleware.RequireScope(model.ScopeOrdersRead)).Post("/orders", orderHandler.List)
+		r.With(middleware.RequireScope(model.ScopeOrdersRead)).Post("/orders/export", orderHandler.Export)
+		r.With(middleware.RequireScope(model.ScopeOrdersRead)).Get("/orders/events", orderHandler.Events)
+		r.With(middleware.RequireScope(model.ScopeOrdersRead)).Get("/orders/{orderID}/timeline", orderHandler.Timeline)
+		r.With(middleware.RequireScope(model.ScopeProductsRead)).Get("/image", productHandler.GetImage)
+
+		// 全ユーザーの注文を集計するため、管理者とオペレーターのみ
+		// (店舗管理者は全ユーザーの既定のロールのため許可しない)
+		r.With(
+			middleware.RequireRole(model.RoleAdmin, model.RoleOperator),
+			middleware.RequireScope(model.ScopeOrdersRead),
+		).Get("/stats/delivery", statsHandler.Delivery)
+
+		// 状態を変更するルートはCSRFトークンを検証する
+		r.Group(func(r chi.Router) {
+			r.Use(csrfMW)
+
+			// 注文作成は店舗管理者と管理者のみ
+			r.With(
+				middleware.RequireRole(model.RoleStoreManager, model.RoleAdmin),
+				middleware.RequireScope(model.ScopeOrdersWrite),
+			).Post("/product/post", productHandler.CreateOrders)
+
+			// アカウント操作はAPIトークンでは行えない
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireSession)
+				r.Post("/users/me/password", userHandler.ChangePassword)
+				r.Get("/tokens", tokenHandler.List)
+				r.Post("/tokens", tokenHandler.Create)
+				r.Delete("/tokens/{tokenID}", tokenHandler.Revoke)
+				r.Get("/webhooks", webhookHandler.List)
+				r.Post("/webhooks", webhookHandler.Create)
+				r.Delete("/webhooks/{webhookID}", webhookHandler.Delete)
+				r.Get("/webhooks/{webhookID}/deliveries", webhookHandler.ListDeliveries)
+				r.Post("/webhooks/{webhookID}/deliveries/{deliveryID}/retry", webhookHandler.Redeliver)
+
+				// ユーザー管理は管理者のみ
+				r.With(middleware.RequireRole(model.RoleAdmin)).
+					Post("/users", userHandler.Create)
+			})
+		})
 	})
 
 	s.Router.Route("/api/robot", func(r chi.Router) {
@@ -100,14 +295,78 @@ func (s *Server) setupRoutes(
 	})
 }
 
-func (s *Server) Run() {
-	appPort := os.Getenv("PORT")
-	if appPort == "" {
-		appPort = "8080"
+// サーバーを起動し、Shutdownが呼ばれるまでブロックする
+func (s *Server) Run() error {
+	s.logger.Info("starting server", slog.String("addr", s.httpServer.Addr))
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to start server: %w", err)
 	}
+	return nil
+}
+
+// 処理中のリクエストを待ってからサーバーを停止し、DB・Redisの接続を閉じる
+// ctxのデッドラインを過ぎた場合は残りの接続を強制的に閉じる
+func (s *Server) Shutdown(ctx context.Context) error {
+	// ヘルスチェックを503にしてロードバランサーから外れるのを待つ
+	s.ready.Store(false)
+	if s.drainDelay > 0 {
+		s.logger.Info("draining before shutdown", slog.Duration("drain_delay", s.drainDelay))
+		select {
+		case <-time.After(s.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	var errs []error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server shutdown: %w", err))
+		_ = s.httpServer.Close()
+	}
+	// 送信中のWebhookの結果を記録し終えてからDBを閉じる
+	if s.stopWebhookDispatcher != nil {
+		s.stopWebhookDispatcher()
+		select {
+		case <-s.webhookDispatcherDone:
+		case <-ctx.Done():
+			errs = append(errs, errors.New("webhook dispatcher did not stop in time"))
+		}
+	}
+	if s.redisClient != nil {
+		if err := s.redisClient.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("redis close: %w", err))
+		}
+	}
+	if s.replica != nil {
+		if err := s.replica.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("replica close: %w", err))
+		}
+	}
+	if s.dbConn != nil {
+		if err := s.dbConn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("db close: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-	log.Printf("Starting server on :%s", appPort)
-	if err := http.ListenAndServe(":"+appPort, s.Router); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// 設定に応じて未適用のマイグレーションを適用し、スキーマがファイルと一致しているかを確認する
+// 古いスキーマのまま新しいコードでリクエストを受けないよう、不一致の場合は起動を中止する
+func prepareSchema(cfg config.MigrationConfig, dbConn *sqlx.DB, logger *slog.Logger) error {
+	migrator := migration.New(dbConn.DB, os.DirFS(cfg.Dir), cfg.LockTimeout, logger)
+	if cfg.AutoApply {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		logger.Info("schema is up to date", slog.Int("applied", n))
+	}
+	if !cfg.Check {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := migrator.Check(ctx); err != nil {
+		return fmt.Errorf("schema check failed (run `server migrate up` or set MIGRATION_AUTO_APPLY=true): %w", err)
 	}
+	return nil
 }
@@ -8,12 +8,14 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 
+	"backend/internal/logging"
 	"backend/internal/repository"
 	"backend/internal/service/utils"
+	"backend/internal/telemetry"
 
 	"github.com/redis/go-redis/v9"
 
@@ -30,13 +32,15 @@ var (
 
 type AuthService struct {
 	store       *repository.Store
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
+	logger      *slog.Logger
 }
 
-func NewAuthService(store *repository.Store, redisClient *redis.Client) *AuthService {
+func NewAuthService(store *repository.Store, redisClient redis.UniversalClient, logger *slog.Logger) *AuthService {
 	return &AuthService{
 		store:       store,
 		redisClient: redisClient,
+		logger:      logger,
 	}
 }
 
@@ -45,24 +49,25 @@ func NewAuthService(store *repository.Store, redisClient *redis.Client) *AuthSer
 func verifyPassword(storedHash, password string) (bool, error) {
 	// PBKDF2ハッシュのフォーマット：$pbkdf2-sha256$i=10000$salt_base64$hash_base64
 	if strings.HasPrefix(storedHash, "$pbkdf2-sha256$") {
+		// 先頭の$で空の要素ができるため、["", "pbkdf2-sha256", "i=...", salt, hash] の5要素になる
 		parts := strings.Split(storedHash, "$")
-		if len(parts) != 4 {
+		if len(parts) != 5 {
 			return false, errors.New("invalid hash format")
 		}
 
 		// イテレーション回数を解析
 		var iterations int
-		if _, err := fmt.Sscanf(parts[1], "i=%d", &iterations); err != nil {
+		if _, err := fmt.Sscanf(parts[2], "i=%d", &iterations); err != nil {
 			return false, errors.New("invalid iteration format")
 		}
 
 		// ソルトとハッシュをデコード
-		salt, err := base64.StdEncoding.DecodeString(parts[2])
+		salt, err := base64.StdEncoding.DecodeString(parts[3])
 		if err != nil {
 			return false, err
 		}
 
-		storedHashBytes, err := base64.StdEncoding.DecodeString(parts[3])
+		storedHashBytes, err := base64.StdEncoding.DecodeString(parts[4])
 		if err != nil {
 			return false, err
 		}
@@ -90,29 +95,32 @@ func (s *AuthService) Login(ctx context.Context, userName, password string) (str
 	err := utils.WithTimeout(ctx, func(ctx context.Context) error {
 		user, err := s.store.UserRepo.FindByUserName(ctx, userName)
 		if err != nil {
-			log.Printf("[Login] ユーザー検索失敗(userName: %s): %v", userName, err)
+			s.logger.InfoContext(ctx, "login user lookup failed",
+				slog.String("user_name", logging.Redact(userName)), slog.Any("error", err))
 			if errors.Is(err, sql.ErrNoRows) {
 				return ErrUserNotFound
 			}
 			return ErrInternalServer
 		}
 
+		span.SetAttributes(telemetry.AttrUserID.Int(user.UserID))
+
 		// パスワード検証
 		valid, err := verifyPassword(user.PasswordHash, password)
 		if err != nil {
-			log.Printf("[Login] パスワード検証エラー: %v", err)
+			s.logger.ErrorContext(ctx, "password verification error", slog.Int("user_id", user.UserID), slog.Any("error", err))
 			span.RecordError(err)
 			return ErrInternalServer
 		}
 		if !valid {
-			log.Printf("[Login] パスワード検証失敗")
+			s.logger.InfoContext(ctx, "login password mismatch", slog.Int("user_id", user.UserID))
 			return ErrInvalidPassword
 		}
 
 		sessionDuration := 24 * time.Hour
 		sessionID, expiresAt, err = s.store.SessionRepo.Create(ctx, user.UserID, sessionDuration)
 		if err != nil {
-			log.Printf("[Login] セッション生成失敗: %v", err)
+			s.logger.ErrorContext(ctx, "session creation failed", slog.Int("user_id", user.UserID), slog.Any("error", err))
 			return ErrInternalServer
 		}
 
@@ -123,15 +131,16 @@ func (s *AuthService) Login(ctx context.Context, userName, password string) (str
 			sessionData := map[string]interface{}{
 				"user_id":    user.UserID,
 				"expires_at": expiresAt.Unix(),
+				"role":       user.Role,
 			}
 
 			// セッションと同じ期間キャッシュを保持
 			if err := s.redisClient.HSet(ctx, cacheKey, sessionData).Err(); err != nil {
-				log.Printf("[Login] セッションキャッシュ保存失敗: %v", err)
+				s.logger.WarnContext(ctx, "session cache store failed", slog.Any("error", err))
 				// キャッシュ失敗はエラーとして扱わない（アプリケーション続行可能）
 			} else {
 				s.redisClient.Expire(ctx, cacheKey, time.Until(expiresAt))
-				log.Printf("[Login] セッションキャッシュ保存成功: %s", sessionID)
+				s.logger.DebugContext(ctx, "session cached", slog.String("session_id", logging.Redact(sessionID)))
 			}
 		}
 
@@ -139,9 +148,10 @@ func (s *AuthService) Login(ctx context.Context, userName, password string) (str
 	})
 
 	if err != nil {
+		telemetry.RecordError(span, spanError(err))
 		return "", time.Time{}, err
 	}
 
-	log.Printf("Login successful for UserName '%s', session created.", userName)
+	s.logger.InfoContext(ctx, "login succeeded", slog.String("user_name", logging.Redact(userName)))
 	return sessionID, expiresAt, nil
 }
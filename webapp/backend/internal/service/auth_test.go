@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"backend/internal/service/utils"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestVerifyPasswordPBKDF2(t *testing.T) {
+	// HashPasswordPBKDF2と同じ形式を固定のソルトで作る
+	salt := []byte("0123456789abcdef")
+	key := pbkdf2.Key([]byte("correct horse"), salt, 1000, 32, sha256.New)
+	fixed := fmt.Sprintf("$pbkdf2-sha256$i=1000$%s$%s",
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key))
+
+	generated, err := utils.HashPasswordPBKDF2("correct horse")
+	if err != nil {
+		t.Fatalf("HashPasswordPBKDF2: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"fixed hash", fixed, "correct horse", true},
+		{"fixed hash with wrong password", fixed, "battery staple", false},
+		{"generated hash", generated, "correct horse", true},
+		{"generated hash with wrong password", generated, "battery staple", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := verifyPassword(tc.hash, tc.password)
+			if err != nil {
+				t.Fatalf("verifyPassword(%q): %v", tc.hash, err)
+			}
+			if got != tc.want {
+				t.Errorf("verifyPassword(%q, %q) = %v, want %v", tc.hash, tc.password, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordPBKDF2InvalidFormat(t *testing.T) {
+	for _, hash := range []string{
+		"$pbkdf2-sha256$i=1000$c2FsdA==",
+		"$pbkdf2-sha256$iterations$c2FsdA==$aGFzaA==",
+		"$pbkdf2-sha256$i=1000$not base64$aGFzaA==",
+	} {
+		if _, err := verifyPassword(hash, "password"); err == nil {
+			t.Errorf("verifyPassword(%q) returned no error", hash)
+		}
+	}
+}
+
+func TestVerifyPasswordBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	if ok, err := verifyPassword(string(hash), "correct horse"); err != nil || !ok {
+		t.Errorf("verifyPassword(bcrypt) = %v, %v, want true", ok, err)
+	}
+	if ok, _ := verifyPassword(string(hash), "battery staple"); ok {
+		t.Error("verifyPassword(bcrypt) accepted a wrong password")
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/internal/model"
+	"backend/internal/repository"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// 依存先ごとのチェックのタイムアウト
+// ロードバランサーのヘルスチェック間隔より十分短くしておく
+const healthCheckTimeout = 1 * time.Second
+
+// チェックに失敗した理由としてレスポンスに含める値
+// エラーの詳細はホスト名などを含みうるため、ログにのみ出力する
+const (
+	healthReasonUnreachable = "unreachable"
+	healthReasonTimeout     = "timeout"
+)
+
+type HealthService struct {
+	dbConn      *sqlx.DB
+	store       *repository.Store
+	redisClient redis.UniversalClient
+	logger      *slog.Logger
+}
+
+func NewHealthService(dbConn *sqlx.DB, store *repository.Store, redisClient redis.UniversalClient, logger *slog.Logger) *HealthService {
+	return &HealthService{
+		dbConn:      dbConn,
+		store:       store,
+		redisClient: redisClient,
+		logger:      logger,
+	}
+}
+
+// MySQL・Redis・マイグレーションの状態を並行して確認する
+//   - MySQLに接続できない場合はunavailable
+//   - Redisはなくても動作するため、接続できない場合はdegraded
+func (s *HealthService) Check(ctx context.Context) model.HealthReport {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		checks = make(map[string]model.HealthCheck, 3)
+	)
+	run := func(name string, fn func(ctx context.Context) model.HealthCheck) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			check := fn(ctx)
+			check.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+			mu.Lock()
+			checks[name] = check
+			mu.Unlock()
+		}()
+	}
+
+	run("mysql", s.checkMySQL)
+	run("redis", s.checkRedis)
+	run("migration", s.checkMigration)
+	wg.Wait()
+
+	status := model.HealthStatusOK
+	if checks["redis"].Status != model.HealthStatusOK || checks["migration"].Status == model.HealthStatusDegraded {
+		status = model.HealthStatusDegraded
+	}
+	if checks["mysql"].Status != model.HealthStatusOK {
+		status = model.HealthStatusUnavailable
+	}
+	return model.HealthReport{Status: status, Checks: checks}
+}
+
+func (s *HealthService) checkMySQL(ctx context.Context) model.HealthCheck {
+	if err := s.dbConn.PingContext(ctx); err != nil {
+		return s.failed(ctx, "mysql", model.HealthStatusUnavailable, err)
+	}
+	return model.HealthCheck{Status: model.HealthStatusOK}
+}
+
+func (s *HealthService) checkRedis(ctx context.Context) model.HealthCheck {
+	if s.redisClient == nil {
+		return model.HealthCheck{Status: model.HealthStatusDegraded, Error: "redis client not initialized"}
+	}
+	if err := s.redisClient.Ping(ctx).Err(); err != nil {
+		return s.failed(ctx, "redis", model.HealthStatusDegraded, err)
+	}
+	return model.HealthCheck{Status: model.HealthStatusOK}
+}
+
+func (s *HealthService) checkMigration(ctx context.Context) model.HealthCheck {
+	version, err := s.store.SchemaRepo.CurrentVersion(ctx)
+	if errors.Is(err, repository.ErrNoSchemaVersion) {
+		return model.HealthCheck{Status: model.HealthStatusUnknown, Version: "unknown"}
+	}
+	if err != nil {
+		return s.failed(ctx, "migration", model.HealthStatusDegraded, err)
+	}
+	return model.HealthCheck{Status: model.HealthStatusOK, Version: strconv.FormatInt(version, 10)}
+}
+
+// 失敗したチェックの結果
+// エラーはログに残し、レスポンスには固定の理由のみを返す
+func (s *HealthService) failed(ctx context.Context, name, status string, err error) model.HealthCheck {
+	s.logger.WarnContext(ctx, "health check failed", slog.String("check", name), slog.Any("error", err))
+	reason := healthReasonUnreachable
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = healthReasonTimeout
+	}
+	return model.HealthCheck{Status: status, Error: reason}
+}
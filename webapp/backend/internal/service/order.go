@@ -1,34 +1,81 @@
 package service
 
 import (
+	"backend/internal/events"
 	"backend/internal/model"
 	"backend/internal/repository"
 	"backend/internal/service/utils"
+	"backend/internal/telemetry"
 	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// 一覧取得のカーソルが不正 (壊れている、または並び順が異なる)
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// リポジトリのカーソルエラーをサービスのエラーに置き換える
+func listError(err error) error {
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return ErrInvalidCursor
+	}
+	return err
+}
+
 type OrderService struct {
-	store *repository.Store
+	store           *repository.Store
+	events          *events.Bus
+	exports         *exportLimiter
+	exportBatchSize int
+	logger          *slog.Logger
 }
 
-func NewOrderService(store *repository.Store) *OrderService {
-	return &OrderService{store: store}
+func NewOrderService(store *repository.Store, bus *events.Bus, export ExportOptions, logger *slog.Logger) *OrderService {
+	return &OrderService{
+		store:           store,
+		events:          bus,
+		exports:         newExportLimiter(export.MaxConcurrentPerUser),
+		exportBatchSize: export.BatchSize,
+		logger:          logger,
+	}
 }
 
 // ユーザーの注文履歴を取得
-func (s *OrderService) FetchOrders(ctx context.Context, userID int, req model.ListRequest) ([]model.Order, int, error) {
+func (s *OrderService) FetchOrders(ctx context.Context, userID int, req model.OrderListRequest) (_ []model.Order, _ model.PageInfo, err error) {
+	ctx, span := otel.Tracer("service.order").Start(ctx, "OrderService.FetchOrders",
+		trace.WithAttributes(append(telemetry.ListAttributes(req.Page, req.PageSize, req.Search, req.SortField),
+			telemetry.AttrUserID.Int(userID))...))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
 	var orders []model.Order
-	var total int
-	err := utils.WithTimeout(ctx, func(ctx context.Context) error {
+	var page model.PageInfo
+	req.Statuses = uniqueStatuses(req.Statuses)
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
 		var fetchErr error
-		orders, total, fetchErr = s.store.OrderRepo.ListOrders(ctx, userID, req)
+		orders, page, fetchErr = s.store.OrderRepo.ListOrders(ctx, userID, req)
 		if fetchErr != nil {
 			return fetchErr
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, 0, err
+		return nil, page, listError(err)
+	}
+	return orders, page, nil
+}
+
+// 絞り込みのステータスから重複を除く
+// 値はOrderListRequest.Validateで検証済み
+func uniqueStatuses(statuses []string) []string {
+	var unique []string
+	for _, status := range statuses {
+		if !slices.Contains(unique, status) {
+			unique = append(unique, status)
+		}
 	}
-	return orders, total, nil
+	return unique
 }
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"backend/internal/events"
+	"backend/internal/model"
+	"backend/internal/telemetry"
+	"context"
+	"errors"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// サーバーの停止中で通知を購読できない
+var ErrEventsUnavailable = errors.New("order events unavailable")
+
+// 注文ステータスの変更通知の購読
+type StatusEventStream struct {
+	sub *events.Subscription
+	// 購読開始前に発生していた、Last-Event-IDより後のイベント (古い順)
+	Backlog []model.OrderStatusEvent
+	// Last-Event-ID以降のイベントを取りこぼしている可能性がある
+	// (クライアントは注文履歴を取得し直す必要がある)
+	Incomplete bool
+}
+
+// 新しいイベントを受け取るチャンネル
+// サーバーの停止時や受信が追いつかない場合に閉じられる
+func (s *StatusEventStream) Events() <-chan model.OrderStatusEvent {
+	return s.sub.Events()
+}
+
+// ユーザーの注文のステータス変更を購読する
+// lastEventIDが0より大きい場合は、その後に発生したイベントをBacklogに入れて返す。
+// 使い終わったらCloseStatusEventsを呼ぶこと
+func (s *OrderService) SubscribeStatusEvents(ctx context.Context, userID int, lastEventID int64) (_ *StatusEventStream, err error) {
+	ctx, span := otel.Tracer("service.order").Start(ctx, "OrderService.SubscribeStatusEvents",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), attribute.Int64("events.last_event_id", lastEventID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	// 再送と新着の間で取りこぼさないよう、先に購読してから履歴を読む
+	// (重複はイベントIDで除く)
+	sub, err := s.events.Subscribe(userID)
+	if err != nil {
+		return nil, ErrEventsUnavailable
+	}
+	stream := &StatusEventStream{sub: sub}
+	if lastEventID <= 0 {
+		return stream, nil
+	}
+
+	backlog, complete, err := s.events.Replay(ctx, userID, lastEventID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to replay order events",
+			slog.Int("user_id", userID), slog.Int64("last_event_id", lastEventID), slog.Any("error", err))
+	}
+	stream.Backlog = backlog
+	stream.Incomplete = !complete
+	span.SetAttributes(attribute.Int("events.backlog", len(backlog)), attribute.Bool("events.incomplete", !complete))
+	return stream, nil
+}
+
+// 購読を終了する
+func (s *OrderService) CloseStatusEvents(stream *StatusEventStream) {
+	s.events.Unsubscribe(stream.sub)
+}
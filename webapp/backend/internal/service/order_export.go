@@ -0,0 +1,106 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/service/utils"
+	"backend/internal/telemetry"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ユーザーが同時に実行できるエクスポートの上限に達している
+var ErrTooManyExports = errors.New("too many concurrent exports")
+
+// 注文履歴エクスポートの設定
+type ExportOptions struct {
+	// ユーザーごとの同時実行数の上限
+	MaxConcurrentPerUser int
+	// 1回のクエリで取得する行数
+	BatchSize int
+}
+
+// ユーザーごとの同時実行数を制限する
+// プロセス内で数えるため、バックエンドを複数台動かす場合の上限は台数倍になる
+type exportLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[int]int
+}
+
+func newExportLimiter(max int) *exportLimiter {
+	return &exportLimiter{max: max, active: make(map[int]int)}
+}
+
+func (l *exportLimiter) acquire(userID int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[userID] >= l.max {
+		return false
+	}
+	l.active[userID]++
+	return true
+}
+
+func (l *exportLimiter) release(userID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[userID]--; l.active[userID] <= 0 {
+		delete(l.active, userID)
+	}
+}
+
+// 絞り込み条件に一致する注文履歴を全件取得し、BatchSize件ずつemitに渡す
+//
+// 全件をメモリに載せないよう、キーセットページングのカーソルで続きを取得する。
+// 最初のemitより前に返したエラー(条件の不正・同時実行数の超過など)であれば、
+// 呼び出し元はまだ何も書き出していない状態でエラーを返せる
+func (s *OrderService) ExportOrders(ctx context.Context, userID int, req model.OrderListRequest, emit func([]model.Order) error) (err error) {
+	ctx, span := otel.Tracer("service.order").Start(ctx, "OrderService.ExportOrders",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), telemetry.AttrListSortField.String(req.SortField)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	req.Statuses = uniqueStatuses(req.Statuses)
+	if !s.exports.acquire(userID) {
+		return ErrTooManyExports
+	}
+	defer s.exports.release(userID)
+
+	includeTotal := false
+	req.IncludeTotal = &includeTotal
+	req.PageSize = s.exportBatchSize
+	req.Page, req.Offset = 1, 0
+
+	exported := 0
+	defer func() { span.SetAttributes(telemetry.AttrResultCount.Int(exported)) }()
+	for {
+		var orders []model.Order
+		var page model.PageInfo
+		// 書き出しの待ち時間を含めないよう、タイムアウトはクエリごとにかける
+		err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+			var fetchErr error
+			orders, page, fetchErr = s.store.OrderRepo.ListOrders(ctx, userID, req)
+			return fetchErr
+		})
+		if err != nil {
+			return listError(err)
+		}
+		if len(orders) > 0 {
+			if err = emit(orders); err != nil {
+				return err
+			}
+			exported += len(orders)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+
+	s.logger.InfoContext(ctx, "orders exported", slog.Int("user_id", userID), slog.Int("count", exported))
+	return nil
+}
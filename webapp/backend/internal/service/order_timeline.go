@@ -0,0 +1,81 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service/utils"
+	"backend/internal/telemetry"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 注文が存在しない、または他人の注文
+var ErrOrderNotFound = errors.New("order not found")
+
+// 注文のステータス変更の履歴を古い順に取得
+func (s *OrderService) GetTimeline(ctx context.Context, userID int, orderID int64) (_ []model.OrderEvent, err error) {
+	ctx, span := otel.Tracer("service.order").Start(ctx, "OrderService.GetTimeline",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), attribute.Int64("order.id", orderID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	var timeline []model.OrderEvent
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		owners, err := s.store.OrderRepo.GetUserIDs(ctx, []int64{orderID})
+		if err != nil {
+			return err
+		}
+		if owner, ok := owners[orderID]; !ok || owner != userID {
+			return ErrOrderNotFound
+		}
+		timeline, err = s.store.OrderEventRepo.ListByOrder(ctx, orderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if timeline == nil {
+		timeline = []model.OrderEvent{}
+	}
+	return timeline, nil
+}
+
+// 同じ変更を受けた注文ごとの履歴を作る (eventのOrderIDは上書きする)
+func orderEvents(orderIDs []int64, event model.OrderEvent) []model.OrderEvent {
+	events := make([]model.OrderEvent, len(orderIDs))
+	for i, orderID := range orderIDs {
+		events[i] = event
+		events[i].OrderID = orderID
+	}
+	return events
+}
+
+// 変更後のステータスに対応する履歴のイベント
+func orderEventForStatus(status string) string {
+	switch status {
+	case model.OrderStatusDelivering:
+		return model.OrderEventClaimed
+	case model.OrderStatusCompleted:
+		return model.OrderEventArrived
+	case model.OrderStatusCancelled:
+		return model.OrderEventCancelled
+	}
+	return model.OrderEventStatusChanged
+}
+
+// 注文の作成を履歴に記録する
+// 作成と同じトランザクション(txStore)で呼ぶこと
+func recordOrdersCreated(ctx context.Context, txStore *repository.Store, userID int, orderIDs []int64) error {
+	return txStore.OrderEventRepo.Append(ctx, orderEvents(orderIDs, model.OrderEvent{
+		EventType:  model.OrderEventCreated,
+		ToStatus:   model.OrderStatusShipping,
+		ActorType:  model.OrderActorUser,
+		ActorID:    strconv.Itoa(userID),
+		OccurredAt: time.Now(),
+	}))
+}
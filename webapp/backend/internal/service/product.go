@@ -3,32 +3,45 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
+	"backend/internal/metrics"
 	"backend/internal/model"
 	"backend/internal/repository"
+	"backend/internal/telemetry"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ProductService struct {
 	store       *repository.Store
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
+	logger      *slog.Logger
 }
 
-func NewProductService(store *repository.Store, redisClient *redis.Client) *ProductService {
+func NewProductService(store *repository.Store, redisClient redis.UniversalClient, logger *slog.Logger) *ProductService {
 	return &ProductService{
 		store:       store,
 		redisClient: redisClient,
+		logger:      logger,
 	}
 }
 
-func (s *ProductService) CreateOrders(ctx context.Context, userID int, items []model.RequestItem) ([]string, error) {
+func (s *ProductService) CreateOrders(ctx context.Context, userID int, items []model.RequestItem) (_ []string, err error) {
+	ctx, span := otel.Tracer("service.product").Start(ctx, "ProductService.CreateOrders",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), attribute.Int("order.items", len(items))))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
 	var insertedOrderIDs []string
 
-	err := s.store.ExecTx(ctx, func(txStore *repository.Store) error {
+	err = s.store.ExecTx(ctx, func(txStore *repository.Store) error {
 		// 注文リストを事前に構築
 		var orders []model.Order
 		for _, item := range items {
@@ -52,25 +65,45 @@ func (s *ProductService) CreateOrders(ctx context.Context, userID int, items []m
 			return err
 		}
 		insertedOrderIDs = ids
-		return nil
+
+		orderIDs := make([]int64, len(ids))
+		for i, id := range ids {
+			if orderIDs[i], err = strconv.ParseInt(id, 10, 64); err != nil {
+				return err
+			}
+		}
+		if err := recordOrdersCreated(ctx, txStore, userID, orderIDs); err != nil {
+			return err
+		}
+		return enqueueOrderWebhooks(ctx, txStore, model.WebhookEventOrderCreated, orderIDs)
 	})
 
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Created %d orders for user %d", len(insertedOrderIDs), userID)
+	span.SetAttributes(telemetry.AttrOrdersCreated.Int(len(insertedOrderIDs)))
+	s.logger.InfoContext(ctx, "orders created", slog.Int("user_id", userID), slog.Int("count", len(insertedOrderIDs)))
 	return insertedOrderIDs, nil
 }
 
-func (s *ProductService) FetchProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, int, error) {
+func (s *ProductService) FetchProducts(ctx context.Context, userID int, req model.ListRequest) ([]model.Product, model.PageInfo, error) {
+	ctx, span := otel.Tracer("service.product").Start(ctx, "ProductService.FetchProducts",
+		trace.WithAttributes(append(telemetry.ListAttributes(req.Page, req.PageSize, req.Search, req.SortField),
+			telemetry.AttrUserID.Int(userID), telemetry.AttrCacheName.String(metrics.CacheProduct))...))
+	defer span.End()
+
 	// キャッシュが無効な場合はDBから取得
 	if s.redisClient == nil {
-		return s.store.ProductRepo.ListProducts(ctx, userID, req)
+		span.SetAttributes(telemetry.AttrCacheHit.Bool(false))
+		products, page, err := s.store.ProductRepo.ListProducts(ctx, userID, req)
+		err = listError(err)
+		telemetry.RecordError(span, spanError(err))
+		return products, page, err
 	}
 
 	// キャッシュキーの作成
-	cacheKey := fmt.Sprintf("products:user:%d:page:%d:size:%d:sort:%s:%s:search:%s",
-		userID, req.Page, req.PageSize, req.SortField, req.SortOrder, req.Search)
+	cacheKey := fmt.Sprintf("products:v2:user:%d:page:%d:size:%d:sort:%s:%s:search:%s:cursor:%s:total:%t",
+		userID, req.Page, req.PageSize, req.SortField, req.SortOrder, req.Search, req.Cursor, req.WantTotal())
 
 	// キャッシュから取得を試みる
 	cachedData, err := s.redisClient.Get(ctx, cacheKey).Result()
@@ -78,28 +111,38 @@ func (s *ProductService) FetchProducts(ctx context.Context, userID int, req mode
 		// キャッシュヒット
 		var result struct {
 			Products []model.Product `json:"products"`
-			Total    int             `json:"total"`
+			Page     model.PageInfo  `json:"page"`
 		}
-		if err := json.Unmarshal([]byte(cachedData), &result); err == nil {
-			log.Printf("Cache hit for products: %s", cacheKey)
-			return result.Products, result.Total, nil
+		err := json.Unmarshal([]byte(cachedData), &result)
+		if err == nil {
+			metrics.CacheHit(metrics.CacheProduct)
+			span.SetAttributes(telemetry.AttrCacheHit.Bool(true))
+			return result.Products, result.Page, nil
 		}
 		// 解析エラーがあっても通常のフローで続行
+		telemetry.CacheFallback(span, metrics.CacheProduct, "decode_error", err)
+	} else if !errors.Is(err, redis.Nil) {
+		// Redis障害時はDBにフォールバックする
+		telemetry.CacheFallback(span, metrics.CacheProduct, "redis_error", err)
 	}
+	metrics.CacheMiss(metrics.CacheProduct)
+	span.SetAttributes(telemetry.AttrCacheHit.Bool(false))
 
 	// DBから取得
-	products, total, err := s.store.ProductRepo.ListProducts(ctx, userID, req)
+	products, page, err := s.store.ProductRepo.ListProducts(ctx, userID, req)
 	if err != nil {
-		return nil, 0, err
+		err = listError(err)
+		telemetry.RecordError(span, spanError(err))
+		return nil, page, err
 	}
 
 	// キャッシュに結果を保存
 	result := struct {
 		Products []model.Product `json:"products"`
-		Total    int             `json:"total"`
+		Page     model.PageInfo  `json:"page"`
 	}{
 		Products: products,
-		Total:    total,
+		Page:     page,
 	}
 
 	jsonData, err := json.Marshal(result)
@@ -107,11 +150,9 @@ func (s *ProductService) FetchProducts(ctx context.Context, userID int, req mode
 		// キャッシュに2分間保存
 		expiration := 2 * time.Minute
 		if err := s.redisClient.Set(ctx, cacheKey, jsonData, expiration).Err(); err != nil {
-			log.Printf("Failed to cache products: %v", err)
-		} else {
-			log.Printf("Cached products with key: %s", cacheKey)
+			s.logger.WarnContext(ctx, "product cache store failed", slog.Any("error", err))
 		}
 	}
 
-	return products, total, nil
+	return products, page, nil
 }
@@ -1,22 +1,30 @@
 package service
 
 import (
+	"backend/internal/events"
+	"backend/internal/metrics"
 	"backend/internal/model"
 	"backend/internal/repository"
 	"backend/internal/service/utils"
+	"backend/internal/telemetry"
 	"context"
-	"log"
+	"log/slog"
+	"sort"
+	"time"
 	
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type RobotService struct {
-	store *repository.Store
+	store  *repository.Store
+	events *events.Bus
+	logger *slog.Logger
 }
 
-func NewRobotService(store *repository.Store) *RobotService {
-	return &RobotService{store: store}
+func NewRobotService(store *repository.Store, bus *events.Bus, logger *slog.Logger) *RobotService {
+	return &RobotService{store: store, events: bus, logger: logger}
 }
 
 func (s *RobotService) GenerateDeliveryPlan(ctx context.Context, robotID string, capacity int) (*model.DeliveryPlan, error) {
@@ -38,7 +46,12 @@ func (s *RobotService) GenerateDeliveryPlan(ctx context.Context, robotID string,
 			}
 			
 			_, planSpan := tracer.Start(ctx, "SelectOrdersForDelivery")
+			solveStart := time.Now()
 			plan, err = selectOrdersForDelivery(ctx, orders, robotID, capacity)
+			if err == nil {
+				plan.PlanID, err = newUUID()
+			}
+			metrics.ObserveKnapsack(len(orders), capacity, time.Since(solveStart))
 			planSpan.SetAttributes(
 				attribute.Int("plan.orders_count", len(plan.Orders)),
 				attribute.Int("plan.total_weight", plan.TotalWeight),
@@ -62,21 +75,116 @@ func (s *RobotService) GenerateDeliveryPlan(ctx context.Context, robotID string,
 				}
 				updateSpan.SetAttributes(attribute.Int("updated.orders_count", len(orderIDs)))
 				updateSpan.End()
-				log.Printf("Updated status to 'delivering' for %d orders", len(orderIDs))
+				// 候補はshippingの注文のみ
+				now := time.Now()
+				from := model.OrderStatusShipping
+				err := txStore.OrderEventRepo.Append(ctx, orderEvents(orderIDs, model.OrderEvent{
+					EventType:  model.OrderEventClaimed,
+					FromStatus: &from,
+					ToStatus:   model.OrderStatusDelivering,
+					ActorType:  model.OrderActorRobot,
+					ActorID:    robotID,
+					PlanID:     &plan.PlanID,
+					OccurredAt: now,
+				}))
+				if err != nil {
+					return err
+				}
+				if err := txStore.PlanRepo.Create(ctx, plan, capacity, now); err != nil {
+					return err
+				}
+				if err := enqueueOrderWebhooks(ctx, txStore, model.WebhookEventOrderDelivering, orderIDs); err != nil {
+					return err
+				}
+				s.logger.InfoContext(ctx, "orders assigned to delivery",
+					slog.String("robot_id", robotID), slog.String("plan_id", plan.PlanID), slog.Int("count", len(orderIDs)))
 			}
 			return nil
 		})
 	})
 	if err != nil {
+		telemetry.RecordError(span, err)
 		return nil, err
 	}
+	if len(plan.Orders) > 0 {
+		orderIDs := make([]int64, len(plan.Orders))
+		for i, order := range plan.Orders {
+			orderIDs[i] = order.OrderID
+		}
+		s.notifyStatusChange(ctx, orderIDs, model.OrderStatusDelivering)
+	}
 	return &plan, nil
 }
 
-func (s *RobotService) UpdateOrderStatus(ctx context.Context, orderID int64, newStatus string) error {
-	return utils.WithTimeout(ctx, func(ctx context.Context) error {
-		return s.store.OrderRepo.UpdateStatuses(ctx, []int64{orderID}, newStatus)
+func (s *RobotService) UpdateOrderStatus(ctx context.Context, robotID string, orderID int64, newStatus string) (err error) {
+	ctx, span := otel.Tracer("service.robot").Start(ctx, "RobotService.UpdateOrderStatus",
+		trace.WithAttributes(attribute.String("robot.id", robotID), attribute.Int64("order.id", orderID),
+			telemetry.AttrOrderStatus.String(newStatus)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	// 存在しない注文や、ステータスが変わらない報告(ロボットの再送など)は
+	// 履歴・Webhook・通知のいずれにも出さない
+	var changed bool
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		return s.store.ExecTx(ctx, func(txStore *repository.Store) error {
+			// 変更前のステータスを履歴に残すため、更新まで他の変更をブロックする
+			previous, err := txStore.OrderRepo.LockStatuses(ctx, []int64{orderID})
+			if err != nil {
+				return err
+			}
+			if err := txStore.OrderRepo.UpdateStatuses(ctx, []int64{orderID}, newStatus); err != nil {
+				return err
+			}
+			from, ok := previous[orderID]
+			changed = ok && from != newStatus
+			if !changed {
+				return nil
+			}
+			err = txStore.OrderEventRepo.Append(ctx, orderEvents([]int64{orderID}, model.OrderEvent{
+				EventType:  orderEventForStatus(newStatus),
+				FromStatus: &from,
+				ToStatus:   newStatus,
+				ActorType:  model.OrderActorRobot,
+				ActorID:    robotID,
+				OccurredAt: time.Now(),
+			}))
+			if err != nil {
+				return err
+			}
+			if eventType := webhookEventForStatus(newStatus); eventType != "" {
+				return enqueueOrderWebhooks(ctx, txStore, eventType, []int64{orderID})
+			}
+			return nil
+		})
 	})
+	if err != nil {
+		return err
+	}
+	if changed {
+		s.notifyStatusChange(ctx, []int64{orderID}, newStatus)
+	}
+	return nil
+}
+
+// ステータスの変更を注文したユーザーに通知する
+// 更新はコミット済みのため、通知に失敗しても記録するだけにする
+func (s *RobotService) notifyStatusChange(ctx context.Context, orderIDs []int64, status string) {
+	owners, err := s.store.OrderRepo.GetUserIDs(ctx, orderIDs)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to look up order owners for notification",
+			slog.Int("count", len(orderIDs)), slog.Any("error", err))
+		return
+	}
+	now := time.Now()
+	evs := make([]model.OrderStatusEvent, 0, len(owners))
+	for orderID, userID := range owners {
+		evs = append(evs, model.OrderStatusEvent{OrderID: orderID, UserID: userID, Status: status, OccurredAt: now})
+	}
+	sort.Slice(evs, func(i, j int) bool { return evs[i].OrderID < evs[j].OrderID })
+	if err := s.events.Publish(ctx, evs); err != nil {
+		s.logger.WarnContext(ctx, "failed to publish order status events",
+			slog.Int("count", len(evs)), slog.Any("error", err))
+	}
 }
 
 func selectOrdersForDelivery(ctx context.Context, orders []model.Order, robotID string, robotCapacity int) (model.DeliveryPlan, error) {
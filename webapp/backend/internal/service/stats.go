@@ -0,0 +1,163 @@
+package service
+
+import (
+	"backend/internal/metrics"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service/utils"
+	"backend/internal/telemetry"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 集計期間が不正
+var ErrInvalidStatsWindow = errors.New("invalid stats window")
+
+const (
+	// 期間を指定しない場合の集計期間
+	defaultStatsWindow = 7 * 24 * time.Hour
+	// 商品別の件数を返す上限
+	statsTopProducts = 20
+)
+
+type StatsOptions struct {
+	// 結果をRedisにキャッシュする時間 (0の場合はキャッシュしない)
+	CacheTTL time.Duration
+	// 一度に集計できる最大の期間
+	MaxWindow time.Duration
+}
+
+type StatsService struct {
+	store       *repository.Store
+	redisClient redis.UniversalClient
+	opts        StatsOptions
+	logger      *slog.Logger
+}
+
+func NewStatsService(store *repository.Store, redisClient redis.UniversalClient, opts StatsOptions, logger *slog.Logger) *StatsService {
+	return &StatsService{store: store, redisClient: redisClient, opts: opts, logger: logger}
+}
+
+// 期間 [from, to) の配送統計を取得
+// from・toを省略した場合は直近7日間。同じ期間の結果はCacheTTLの間キャッシュするため、
+// 省略時のtoは分単位に切り捨てる
+func (s *StatsService) DeliveryStats(ctx context.Context, from, to *time.Time) (_ *model.DeliveryStats, err error) {
+	ctx, span := otel.Tracer("service.stats").Start(ctx, "StatsService.DeliveryStats",
+		trace.WithAttributes(telemetry.AttrCacheName.String(metrics.CacheStats)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	start, end, err := s.statsWindow(from, to)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.String("stats.from", start.Format(time.RFC3339)),
+		attribute.String("stats.to", end.Format(time.RFC3339)),
+	)
+
+	cacheKey := fmt.Sprintf("stats:delivery:v1:%d:%d", start.UnixNano(), end.UnixNano())
+	if stats, ok := s.cachedStats(ctx, span, cacheKey); ok {
+		return stats, nil
+	}
+
+	stats := &model.DeliveryStats{From: start, To: end, GeneratedAt: time.Now()}
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		var err error
+		if stats.StatusCounts, err = s.store.StatsRepo.CountByStatus(ctx, start, end); err != nil {
+			return err
+		}
+		if stats.DeliveryTime, err = s.store.StatsRepo.DeliveryTime(ctx, start, end); err != nil {
+			return err
+		}
+		if stats.Products, err = s.store.StatsRepo.ProductVolumes(ctx, start, end, statsTopProducts); err != nil {
+			return err
+		}
+		stats.Robots, err = s.store.StatsRepo.RobotThroughput(ctx, start, end)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stats.Products == nil {
+		stats.Products = []model.ProductVolume{}
+	}
+	if stats.Robots == nil {
+		stats.Robots = []model.RobotThroughput{}
+	}
+	hours := end.Sub(start).Hours()
+	for i := range stats.Robots {
+		robot := &stats.Robots[i]
+		robot.DeliveredPerHour = float64(robot.Delivered) / hours
+		if robot.TotalCapacity > 0 {
+			robot.CapacityUtilization = float64(robot.TotalWeight) / float64(robot.TotalCapacity)
+		}
+	}
+
+	s.storeStats(ctx, cacheKey, stats)
+	return stats, nil
+}
+
+// 集計期間を決めて検証する
+func (s *StatsService) statsWindow(from, to *time.Time) (time.Time, time.Time, error) {
+	end := time.Now().Truncate(time.Minute)
+	if to != nil {
+		end = *to
+	}
+	start := end.Add(-defaultStatsWindow)
+	if from != nil {
+		start = *from
+	}
+	if !start.Before(end) {
+		return start, end, invalidField(ErrInvalidStatsWindow, "from", "must be before to")
+	}
+	if end.Sub(start) > s.opts.MaxWindow {
+		return start, end, invalidField(ErrInvalidStatsWindow, "from", fmt.Sprintf("must be within %s of to", s.opts.MaxWindow))
+	}
+	return start, end, nil
+}
+
+// キャッシュ済みの結果を取得する
+// Redisに接続できない場合や壊れたデータの場合は集計し直す
+func (s *StatsService) cachedStats(ctx context.Context, span trace.Span, key string) (*model.DeliveryStats, bool) {
+	if s.redisClient == nil || s.opts.CacheTTL <= 0 {
+		span.SetAttributes(telemetry.AttrCacheHit.Bool(false))
+		return nil, false
+	}
+	data, err := s.redisClient.Get(ctx, key).Bytes()
+	if err == nil {
+		var stats model.DeliveryStats
+		if err := json.Unmarshal(data, &stats); err == nil {
+			metrics.CacheHit(metrics.CacheStats)
+			span.SetAttributes(telemetry.AttrCacheHit.Bool(true))
+			return &stats, true
+		}
+		telemetry.CacheFallback(span, metrics.CacheStats, "decode_error", err)
+	} else if !errors.Is(err, redis.Nil) {
+		telemetry.CacheFallback(span, metrics.CacheStats, "redis_error", err)
+	}
+	metrics.CacheMiss(metrics.CacheStats)
+	span.SetAttributes(telemetry.AttrCacheHit.Bool(false))
+	return nil, false
+}
+
+func (s *StatsService) storeStats(ctx context.Context, key string, stats *model.DeliveryStats) {
+	if s.redisClient == nil || s.opts.CacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return
+	}
+	if err := s.redisClient.Set(ctx, key, data, s.opts.CacheTTL).Err(); err != nil {
+		s.logger.WarnContext(ctx, "stats cache store failed", slog.Any("error", err))
+	}
+}
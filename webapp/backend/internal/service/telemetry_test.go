@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"backend/internal/logging"
+	"backend/internal/metrics"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/repository/repositorytest"
+	"backend/internal/telemetry"
+	"backend/internal/telemetry/telemetrytest"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func newTestProductService(redisClient redis.UniversalClient) *ProductService {
+	store := repository.NewStore(&repositorytest.DB{LastInsertID: 100}, nil)
+	store.ProductRepo = &repositorytest.ProductRepo{Products: []model.Product{{ProductID: 1, Name: "mug"}}}
+	return NewProductService(store, redisClient, logging.New(io.Discard, slog.LevelError))
+}
+
+// 接続できないRedis
+func unreachableRedis() redis.UniversalClient {
+	return redis.NewClient(&redis.Options{
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+		MaxRetries:    -1,
+		DialerRetries: 1,
+	})
+}
+
+func TestCreateOrdersSpans(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	s := newTestProductService(nil)
+	ids, err := s.CreateOrders(context.Background(), 7, []model.RequestItem{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 1},
+		{ProductID: 3, Quantity: 0},
+	})
+	if err != nil {
+		t.Fatalf("CreateOrders: %v", err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("CreateOrders returned %d ids, want 3", len(ids))
+	}
+
+	if err := rec.Assert("ProductService.CreateOrders",
+		telemetrytest.HasInt(telemetry.AttrUserID, 7),
+		telemetrytest.HasInt(telemetry.AttrOrdersCreated, 3),
+		telemetrytest.HasStatus(codes.Unset),
+	); err != nil {
+		t.Error(err)
+	}
+	if err := rec.Assert("OrderRepository.CreateBulk",
+		telemetrytest.HasInt(telemetry.AttrOrdersCreated, 3),
+		telemetrytest.HasParent(rec, "ProductService.CreateOrders"),
+	); err != nil {
+		t.Error(err)
+	}
+	if err := rec.Assert("Store.ExecTx",
+		telemetrytest.HasParent(rec, "ProductService.CreateOrders"),
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchProductsSpanWithoutCache(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	s := newTestProductService(nil)
+	req := model.ListRequest{Page: 2, PageSize: 20, Search: "マグ", SortField: "name"}
+	if _, _, err := s.FetchProducts(context.Background(), 7, req); err != nil {
+		t.Fatalf("FetchProducts: %v", err)
+	}
+	if err := rec.Assert("ProductService.FetchProducts",
+		telemetrytest.HasInt(telemetry.AttrUserID, 7),
+		telemetrytest.HasString(telemetry.AttrCacheName, metrics.CacheProduct),
+		telemetrytest.HasBool(telemetry.AttrCacheHit, false),
+		telemetrytest.HasInt(telemetry.AttrListPage, 2),
+		telemetrytest.HasInt(telemetry.AttrListPageSize, 20),
+		// 検索語は長さ(文字数)のみ記録する
+		telemetrytest.HasInt(telemetry.AttrListSearchLen, 2),
+		telemetrytest.HasString(telemetry.AttrListSortField, "name"),
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchProductsSpanFallsBackOnRedisError(t *testing.T) {
+	rec := telemetrytest.Install()
+	defer rec.Close()
+
+	client := unreachableRedis()
+	defer client.Close()
+	s := newTestProductService(client)
+	products, _, err := s.FetchProducts(context.Background(), 7, model.ListRequest{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatalf("FetchProducts: %v", err)
+	}
+	if len(products) != 1 {
+		t.Errorf("FetchProducts returned %d products, want 1", len(products))
+	}
+	if err := rec.Assert("ProductService.FetchProducts",
+		telemetrytest.HasEvent(telemetry.EventCacheFallback),
+		telemetrytest.HasBool(telemetry.AttrCacheHit, false),
+		// DBから取得できているため、スパンはエラーにしない
+		telemetrytest.HasStatus(codes.Unset),
+	); err != nil {
+		t.Error(err)
+	}
+}
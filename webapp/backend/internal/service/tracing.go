@@ -0,0 +1,31 @@
+package service
+
+import "errors"
+
+// クライアント起因のエラー (入力不正・未検出・認証失敗など)
+// 正常な業務フローの一部なので、スパンのエラーとしては記録しない
+var clientErrors = []error{
+	ErrUserNotFound,
+	ErrInvalidPassword,
+	ErrUserAlreadyExists,
+	ErrInvalidUserInput,
+	ErrTokenNotFound,
+	ErrInvalidTokenInput,
+	ErrInvalidCursor,
+	ErrTooManyExports,
+	ErrWebhookNotFound,
+	ErrInvalidWebhookInput,
+	ErrDeliveryNotRedeliverable,
+	ErrOrderNotFound,
+	ErrInvalidStatsWindow,
+}
+
+// スパンに記録すべきエラーのみを返す
+func spanError(err error) error {
+	for _, target := range clientErrors {
+		if errors.Is(err, target) {
+			return nil
+		}
+	}
+	return err
+}
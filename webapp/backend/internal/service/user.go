@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service/utils"
+	"backend/internal/telemetry"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrInvalidUserInput  = errors.New("invalid user input")
+)
+
+const (
+	minPasswordLength = 8
+	maxUserNameLength = 255
+)
+
+type UserService struct {
+	store       *repository.Store
+	redisClient redis.UniversalClient
+	logger      *slog.Logger
+}
+
+func NewUserService(store *repository.Store, redisClient redis.UniversalClient, logger *slog.Logger) *UserService {
+	return &UserService{
+		store:       store,
+		redisClient: redisClient,
+		logger:      logger,
+	}
+}
+
+// 管理者によるユーザー作成
+// ロール未指定の場合は店舗管理者として作成する
+func (s *UserService) CreateUser(ctx context.Context, req model.CreateUserRequest) (_ *model.User, err error) {
+	ctx, span := otel.Tracer("service.user").Start(ctx, "UserService.CreateUser")
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	userName := strings.TrimSpace(req.UserName)
+	if userName == "" || utf8.RuneCountInString(userName) > maxUserNameLength {
+		return nil, invalidField(ErrInvalidUserInput, "user_name", fmt.Sprintf("must be 1-%d characters", maxUserNameLength))
+	}
+	if err := validatePassword("password", req.Password); err != nil {
+		return nil, err
+	}
+	role := req.Role
+	if role == "" {
+		role = model.RoleStoreManager
+	}
+	if !model.IsValidRole(role) {
+		return nil, invalidField(ErrInvalidUserInput, "role", "must be one of store_manager, admin, operator")
+	}
+
+	hash, err := utils.HashPasswordPBKDF2(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		UserName:     userName,
+		PasswordHash: hash,
+		Role:         role,
+	}
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		id, err := s.store.UserRepo.Create(ctx, user)
+		if err != nil {
+			if errors.Is(err, repository.ErrDuplicateEntry) {
+				return ErrUserAlreadyExists
+			}
+			return err
+		}
+		user.UserID = id
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(telemetry.AttrUserID.Int(user.UserID), attribute.String("user.role", user.Role))
+	s.logger.InfoContext(ctx, "user created", slog.Int("user_id", user.UserID), slog.String("role", user.Role))
+	return user, nil
+}
+
+// 本人によるパスワード変更
+// 現在のパスワードを検証し、変更後は現在のセッション以外を全て無効化する
+func (s *UserService) ChangePassword(ctx context.Context, userID int, currentSessionID, currentPassword, newPassword string) (err error) {
+	ctx, span := otel.Tracer("service.user").Start(ctx, "UserService.ChangePassword",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	if err := validatePassword("new_password", newPassword); err != nil {
+		return err
+	}
+
+	var revoked []string
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		return s.store.ExecTx(ctx, func(txStore *repository.Store) error {
+			user, err := txStore.UserRepo.FindByID(ctx, userID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return ErrUserNotFound
+				}
+				return err
+			}
+
+			valid, err := verifyPassword(user.PasswordHash, currentPassword)
+			if err != nil {
+				return err
+			}
+			if !valid {
+				return ErrInvalidPassword
+			}
+
+			hash, err := utils.HashPasswordPBKDF2(newPassword)
+			if err != nil {
+				return err
+			}
+			if err := txStore.UserRepo.UpdatePasswordHash(ctx, userID, hash); err != nil {
+				return err
+			}
+
+			revoked, err = txStore.SessionRepo.DeleteByUserExcept(ctx, userID, currentSessionID)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// DBから削除したセッションのキャッシュも破棄する
+	if s.redisClient != nil && len(revoked) > 0 {
+		keys := make([]string, len(revoked))
+		for i, id := range revoked {
+			keys[i] = "session:" + id
+		}
+		if err := s.redisClient.Del(ctx, keys...).Err(); err != nil {
+			span.AddEvent("cache.invalidation_failed", trace.WithAttributes(telemetry.AttrCacheName.String("session")))
+			s.logger.WarnContext(ctx, "session cache invalidation failed", slog.Int("user_id", userID), slog.Any("error", err))
+		}
+	}
+
+	span.SetAttributes(attribute.Int("sessions.revoked_count", len(revoked)))
+	s.logger.InfoContext(ctx, "password changed", slog.Int("user_id", userID), slog.Int("revoked_sessions", len(revoked)))
+	return nil
+}
+
+// fieldはエラーの詳細に含めるフィールド名 (作成時はpassword、変更時はnew_password)
+func validatePassword(field, password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return invalidField(ErrInvalidUserInput, field, fmt.Sprintf("must be at least %d characters", minPasswordLength))
+	}
+	return nil
+}
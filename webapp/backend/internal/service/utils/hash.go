@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -29,3 +30,10 @@ func HashPasswordPBKDF2(password string) (string, error) {
 		base64.StdEncoding.EncodeToString(salt),
 		base64.StdEncoding.EncodeToString(hash)), nil
 }
+
+// HashAPIToken はAPIトークンを保存・照合用にSHA-256でハッシュ化します
+// トークン自体が十分なエントロピーを持つため、ソルトやストレッチングは行いません
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"strings"
+
+	"backend/internal/model"
+)
+
+// 入力の検証エラー
+// Errは対応するサービスのエラー(ErrInvalidUserInputなど)で、errors.Isで判定できる。
+// ハンドラーはerrors.AsでDetailsを取り出し、エラーレスポンスの詳細として返す
+type ValidationError struct {
+	Err     error
+	Details []model.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Details))
+	for i, d := range e.Details {
+		reasons[i] = d.Error()
+	}
+	return e.Err.Error() + ": " + strings.Join(reasons, ", ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// 1つのフィールドの検証エラー
+// 特定のフィールドに対応しない場合はfieldを空にする
+func invalidField(err error, field, reason string) error {
+	return &ValidationError{Err: err, Details: []model.FieldError{{Field: field, Reason: reason}}}
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service/utils"
+	"backend/internal/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrInvalidWebhookInput = errors.New("invalid webhook input")
+	// 送信履歴が存在しない、または再送できる状態(dead)ではない
+	ErrDeliveryNotRedeliverable = errors.New("webhook delivery not found or not dead")
+)
+
+const (
+	// シークレットの接頭辞。漏洩時にシークレットスキャナで検出しやすくするため
+	webhookSecretPrefix = "whsec_"
+	maxWebhookURLLength = 2048
+	maxWebhooksPerUser  = 10
+	// 送信履歴の取得件数の上限
+	maxWebhookDeliveries = 100
+)
+
+type WebhookService struct {
+	store  *repository.Store
+	logger *slog.Logger
+}
+
+func NewWebhookService(store *repository.Store, logger *slog.Logger) *WebhookService {
+	return &WebhookService{store: store, logger: logger}
+}
+
+// Webhookを登録する
+// 署名のシークレットはこの戻り値でのみ取得できる
+func (s *WebhookService) Create(ctx context.Context, userID int, req model.CreateWebhookRequest) (_ *model.CreateWebhookResponse, err error) {
+	ctx, span := otel.Tracer("service.webhook").Start(ctx, "WebhookService.Create",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if len(req.EventTypes) == 0 {
+		return nil, invalidField(ErrInvalidWebhookInput, "event_types", "must contain at least one event type")
+	}
+	var eventTypes []string
+	for i, eventType := range req.EventTypes {
+		if !model.IsValidWebhookEvent(eventType) {
+			return nil, invalidField(ErrInvalidWebhookInput, fmt.Sprintf("event_types[%d]", i), fmt.Sprintf("unknown event type %q", eventType))
+		}
+		if !slices.Contains(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	webhook := model.Webhook{
+		UserID:     userID,
+		URL:        req.URL,
+		Secret:     webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret),
+		EventTypes: eventTypes,
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		count, err := s.store.WebhookRepo.CountByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if count >= maxWebhooksPerUser {
+			return invalidField(ErrInvalidWebhookInput, "", fmt.Sprintf("up to %d webhooks per user", maxWebhooksPerUser))
+		}
+		id, err := s.store.WebhookRepo.Create(ctx, &webhook)
+		if err != nil {
+			return err
+		}
+		webhook.WebhookID = id
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "webhook created",
+		slog.Int("user_id", userID), slog.Int64("webhook_id", webhook.WebhookID), slog.Any("event_types", eventTypes))
+	return &model.CreateWebhookResponse{Secret: webhook.Secret, Webhook: webhook}, nil
+}
+
+// 送信先のURLを検証する
+// 内部アドレスへの送信は、名前解決後のアドレスで送信時に拒否する
+func validateWebhookURL(raw string) error {
+	if raw == "" || len(raw) > maxWebhookURLLength {
+		return invalidField(ErrInvalidWebhookInput, "url", fmt.Sprintf("must be 1-%d characters", maxWebhookURLLength))
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return invalidField(ErrInvalidWebhookInput, "url", "must be an absolute http(s) URL")
+	}
+	if u.User != nil {
+		return invalidField(ErrInvalidWebhookInput, "url", "must not contain credentials")
+	}
+	return nil
+}
+
+// ユーザーのWebhook一覧を取得
+func (s *WebhookService) List(ctx context.Context, userID int) (_ []model.Webhook, err error) {
+	ctx, span := otel.Tracer("service.webhook").Start(ctx, "WebhookService.List",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	var webhooks []model.Webhook
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		var err error
+		webhooks, err = s.store.WebhookRepo.ListByUser(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if webhooks == nil {
+		webhooks = []model.Webhook{}
+	}
+	return webhooks, nil
+}
+
+// Webhookを削除する
+func (s *WebhookService) Delete(ctx context.Context, userID int, webhookID int64) (err error) {
+	ctx, span := otel.Tracer("service.webhook").Start(ctx, "WebhookService.Delete",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), attribute.Int64("webhook.id", webhookID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	return utils.WithTimeout(ctx, func(ctx context.Context) error {
+		deleted, err := s.store.WebhookRepo.Delete(ctx, userID, webhookID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return ErrWebhookNotFound
+		}
+		s.logger.InfoContext(ctx, "webhook deleted", slog.Int("user_id", userID), slog.Int64("webhook_id", webhookID))
+		return nil
+	})
+}
+
+// Webhookの送信履歴を新しい順に最大limit件取得
+func (s *WebhookService) ListDeliveries(ctx context.Context, userID int, webhookID int64, limit int) (_ []model.WebhookDelivery, err error) {
+	ctx, span := otel.Tracer("service.webhook").Start(ctx, "WebhookService.ListDeliveries",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), attribute.Int64("webhook.id", webhookID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	if limit <= 0 || limit > maxWebhookDeliveries {
+		limit = maxWebhookDeliveries
+	}
+	var deliveries []model.WebhookDelivery
+	err = utils.WithTimeout(ctx, func(ctx context.Context) error {
+		if _, err := s.store.WebhookRepo.Get(ctx, userID, webhookID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrWebhookNotFound
+			}
+			return err
+		}
+		var err error
+		deliveries, err = s.store.WebhookRepo.ListDeliveries(ctx, webhookID, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// 再試行の上限に達した送信をやり直す
+func (s *WebhookService) Redeliver(ctx context.Context, userID int, webhookID, deliveryID int64) (err error) {
+	ctx, span := otel.Tracer("service.webhook").Start(ctx, "WebhookService.Redeliver",
+		trace.WithAttributes(telemetry.AttrUserID.Int(userID), attribute.Int64("webhook.id", webhookID)))
+	defer func() { telemetry.End(span, spanError(err)) }()
+
+	return utils.WithTimeout(ctx, func(ctx context.Context) error {
+		if _, err := s.store.WebhookRepo.Get(ctx, userID, webhookID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrWebhookNotFound
+			}
+			return err
+		}
+		ok, err := s.store.WebhookRepo.Redeliver(ctx, webhookID, deliveryID, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDeliveryNotRedeliverable
+		}
+		return nil
+	})
+}
+
+// 注文のイベントをWebhookのアウトボックスに追加する
+// 注文の更新と同じトランザクション(txStore)で呼ぶことで、更新がロールバックされた場合は送信されない
+func enqueueOrderWebhooks(ctx context.Context, txStore *repository.Store, eventType string, orderIDs []int64) error {
+	targets, err := txStore.WebhookRepo.FindTargets(ctx, orderIDs)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+
+	now := time.Now()
+	// 同じ注文のイベントは送信先が違っても同じIDにする
+	eventIDs := make(map[int64]string)
+	var deliveries []model.WebhookDelivery
+	for _, t := range targets {
+		if !t.Subscribes(eventType) {
+			continue
+		}
+		eventID, ok := eventIDs[t.OrderID]
+		if !ok {
+			if eventID, err = newUUID(); err != nil {
+				return err
+			}
+			eventIDs[t.OrderID] = eventID
+		}
+		event := model.WebhookEvent{
+			ID:        eventID,
+			Type:      eventType,
+			CreatedAt: now,
+			Data: model.WebhookOrderData{
+				OrderID:       t.OrderID,
+				ProductID:     t.ProductID,
+				ShippedStatus: t.ShippedStatus,
+				CreatedAt:     t.CreatedAt,
+			},
+		}
+		if t.ArrivedAt.Valid {
+			event.Data.ArrivedAt = &t.ArrivedAt.Time
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, model.WebhookDelivery{
+			WebhookID:     t.WebhookID,
+			EventID:       eventID,
+			EventType:     eventType,
+			Payload:       payload,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	return txStore.WebhookRepo.Enqueue(ctx, deliveries)
+}
+
+// UUIDv4形式のID (WebhookのイベントID・配送計画IDに使う)
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// 配送ステータスに対応するWebhookイベント (通知しないステータスの場合は空)
+// order.createdは注文の作成時(ProductService)にのみ送るため、shippingへの変更では送らない
+func webhookEventForStatus(status string) string {
+	switch status {
+	case model.OrderStatusDelivering:
+		return model.WebhookEventOrderDelivering
+	case model.OrderStatusCompleted:
+		return model.WebhookEventOrderArrived
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend/internal/metrics"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/telemetry"
+	"backend/internal/webhook"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// 送信失敗後の待ち時間 (失敗するたびに倍にする)
+	webhookBackoffBase = 30 * time.Second
+	webhookBackoffMax  = time.Hour
+	// 送信中のワーカーが落ちた場合に、他のワーカーが取得し直せるようになるまでの余裕
+	webhookLeaseMargin = 30 * time.Second
+	// 応答のボディは接続の再利用のために読み捨てる (上限以上は読まない)
+	webhookMaxResponseBody = 64 << 10
+)
+
+// Webhookの配信ワーカーの設定
+type WebhookDispatcherOptions struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Timeout      time.Duration
+	MaxAttempts  int
+	// ループバック・プライベートアドレスへの送信を許可する (ローカルでの動作確認用)
+	AllowPrivateTargets bool
+}
+
+// アウトボックスの送信待ちのイベントをWebhookとして送信するワーカー
+//
+// 複数のバックエンドで動かしても、行ロック(SKIP LOCKED)と送信中の期限で同じイベントを
+// 同時に送らないようにしている。ただし送信後の記録に失敗した場合などは再送されうるため、
+// 受信側はイベントIDで重複を除くこと
+type WebhookDispatcher struct {
+	store  *repository.Store
+	client *http.Client
+	opts   WebhookDispatcherOptions
+	logger *slog.Logger
+}
+
+func NewWebhookDispatcher(store *repository.Store, opts WebhookDispatcherOptions, logger *slog.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:  store,
+		client: webhook.NewHTTPClient(opts.Timeout, opts.AllowPrivateTargets),
+		opts:   opts,
+		logger: logger,
+	}
+}
+
+// ctxがキャンセルされるまで、PollIntervalごとに送信待ちのイベントを送信する
+// 送信中のイベントは送信し終えてから戻る
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// 溜まっている場合はバッチが埋まらなくなるまで続けて送る
+		for ctx.Err() == nil {
+			n, err := d.dispatchDue(ctx)
+			if err != nil {
+				d.logger.WarnContext(ctx, "webhook dispatch failed", slog.Any("error", err))
+				break
+			}
+			if n < d.opts.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// 送信時刻を過ぎたイベントを最大BatchSize件取得して並行に送信し、取得した件数を返す
+func (d *WebhookDispatcher) dispatchDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	var due []repository.DueDelivery
+	err := d.store.ExecTx(ctx, func(txStore *repository.Store) error {
+		var err error
+		due, err = txStore.WebhookRepo.ClaimDue(ctx, now, d.opts.BatchSize, now.Add(d.opts.Timeout+webhookLeaseMargin))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// シャットダウン時も送信中のものは送り終える
+	sendCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(sendCtx, delivery)
+		}()
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+// 1件送信し、結果を記録する
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery repository.DueDelivery) {
+	attempt := delivery.Attempts + 1
+	ctx, span := otel.Tracer("service.webhook").Start(ctx, "WebhookDispatcher.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int64("webhook.id", delivery.WebhookID),
+			attribute.Int64("webhook.delivery_id", delivery.DeliveryID),
+			attribute.String("webhook.event_type", delivery.EventType),
+			attribute.Int("webhook.attempt", attempt),
+		))
+
+	statusCode, sendErr := d.send(ctx, delivery)
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	now := time.Now()
+
+	var err error
+	if sendErr == nil {
+		err = d.store.WebhookRepo.MarkSucceeded(ctx, delivery.DeliveryID, attempt, statusCode, now)
+		metrics.WebhookDelivery(model.WebhookDeliverySucceeded)
+	} else {
+		dead := attempt >= d.opts.MaxAttempts
+		next := now.Add(webhookBackoff(attempt))
+		err = d.store.WebhookRepo.MarkFailed(ctx, delivery.DeliveryID, attempt, statusCode, sendErr.Error(), next, dead)
+		result := "retry"
+		if dead {
+			result = model.WebhookDeliveryDead
+			d.logger.WarnContext(ctx, "webhook delivery moved to dead letter",
+				slog.Int64("webhook_id", delivery.WebhookID), slog.Int64("delivery_id", delivery.DeliveryID),
+				slog.Int("attempts", attempt), slog.Any("error", sendErr))
+		}
+		metrics.WebhookDelivery(result)
+	}
+	if err != nil {
+		d.logger.ErrorContext(ctx, "failed to record webhook delivery result",
+			slog.Int64("delivery_id", delivery.DeliveryID), slog.Any("error", err))
+	}
+	telemetry.End(span, sendErr)
+}
+
+// 署名付きでPOSTする。2xx以外の応答はエラーにする
+func (d *WebhookDispatcher) send(ctx context.Context, delivery repository.DueDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "backend-webhook/1.0")
+	req.Header.Set(webhook.HeaderEvent, delivery.EventType)
+	req.Header.Set(webhook.HeaderDelivery, delivery.EventID)
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(delivery.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// attempt回目の失敗後の待ち時間
+// 送信先の復旧直後に一斉に再送しないよう、後半をランダムにする
+func webhookBackoff(attempt int) time.Duration {
+	d := webhookBackoffBase << min(attempt-1, 16)
+	if d <= 0 || d > webhookBackoffMax {
+		d = webhookBackoffMax
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"testing"
+
+	"backend/internal/model"
+)
+
+func TestWebhookEventForStatus(t *testing.T) {
+	for status, want := range map[string]string{
+		model.OrderStatusShipping:   "",
+		model.OrderStatusDelivering: model.WebhookEventOrderDelivering,
+		model.OrderStatusCompleted:  model.WebhookEventOrderArrived,
+		"unknown":                   "",
+	} {
+		if got := webhookEventForStatus(status); got != want {
+			t.Errorf("webhookEventForStatus(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// OTLPの送信プロトコル (OTEL_EXPORTER_OTLP_PROTOCOL)
+const (
+	protocolHTTP = "http/protobuf"
+	protocolGRPC = "grpc"
+)
+
+// シグナルごとのOTLPエンドポイント
+// OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT、OTEL_EXPORTER_OTLP_ENDPOINT、
+// 旧来のOTLP_ENDPOINT (host:port形式のみ) の順に参照する
+func otlpEndpoint(signal string) string {
+	for _, key := range []string{
+		"OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT",
+		"OTEL_EXPORTER_OTLP_ENDPOINT",
+		"OTLP_ENDPOINT",
+	} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// シグナルごとのOTLPプロトコル (未指定の場合はHTTP)
+func otlpProtocol(signal string) string {
+	for _, key := range []string{
+		"OTEL_EXPORTER_OTLP_" + signal + "_PROTOCOL",
+		"OTEL_EXPORTER_OTLP_PROTOCOL",
+	} {
+		if v := os.Getenv(key); v != "" {
+			return strings.ToLower(v)
+		}
+	}
+	return protocolHTTP
+}
+
+// エクスポーターに明示的に渡すhost:port形式のエンドポイント
+// "jaeger:4318" のようなhost:port形式は平文で接続する。
+// "http://collector:4318" のようなURL形式の場合は空を返し、OTEL_EXPORTER_OTLP_*を
+// SDK自身に読ませる (HTTPでは仕様どおり/v1/tracesなどのパスが付与される)
+func hostPortEndpoint(signal string) string {
+	ep := otlpEndpoint(signal)
+	if strings.Contains(ep, "://") {
+		return ""
+	}
+	return ep
+}
+
+func newTraceExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	ep := hostPortEndpoint("TRACES")
+	if otlpProtocol("TRACES") == protocolGRPC {
+		var opts []otlptracegrpc.Option
+		if ep != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(ep), otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+	var opts []otlptracehttp.Option
+	if ep != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(ep), otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+func newMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	ep := hostPortEndpoint("METRICS")
+	if otlpProtocol("METRICS") == protocolGRPC {
+		var opts []otlpmetricgrpc.Option
+		if ep != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(ep), otlpmetricgrpc.WithInsecure())
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+	var opts []otlpmetrichttp.Option
+	if ep != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpoint(ep), otlpmetrichttp.WithInsecure())
+	}
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+func newLogExporter(ctx context.Context) (sdklog.Exporter, error) {
+	ep := hostPortEndpoint("LOGS")
+	if otlpProtocol("LOGS") == protocolGRPC {
+		var opts []otlploggrpc.Option
+		if ep != "" {
+			opts = append(opts, otlploggrpc.WithEndpoint(ep), otlploggrpc.WithInsecure())
+		}
+		return otlploggrpc.New(ctx, opts...)
+	}
+	var opts []otlploghttp.Option
+	if ep != "" {
+		opts = append(opts, otlploghttp.WithEndpoint(ep), otlploghttp.WithInsecure())
+	}
+	return otlploghttp.New(ctx, opts...)
+}
@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// サービス・リポジトリのスパンで共通に使う属性キー
+// ダッシュボードやtelemetrytestでの検証が名前の揺れで壊れないよう、ここで一元管理する
+const (
+	AttrUserID        = attribute.Key("user.id")
+	AttrListPage      = attribute.Key("list.page")
+	AttrListPageSize  = attribute.Key("list.page_size")
+	AttrListSearchLen = attribute.Key("list.search_length")
+	AttrListSortField = attribute.Key("list.sort_field")
+	AttrListCursor    = attribute.Key("list.cursor")
+	AttrResultCount   = attribute.Key("result.count")
+	AttrResultTotal   = attribute.Key("result.total")
+	AttrCacheName     = attribute.Key("cache.name")
+	AttrCacheHit      = attribute.Key("cache.hit")
+	AttrOrdersCreated = attribute.Key("orders.created_count")
+	AttrOrdersUpdated = attribute.Key("orders.updated_count")
+	AttrOrderStatus   = attribute.Key("order.status")
+
+	AttrListFilterStatuses  = attribute.Key("list.filter.statuses")
+	AttrListFilterProductID = attribute.Key("list.filter.product_id")
+	AttrListFilterDateRange = attribute.Key("list.filter.date_range")
+)
+
+// Store.ExecTxのトランザクション属性と再試行イベント
+const (
+	AttrTxAttempts    = attribute.Key("db.tx.attempts")
+	AttrTxReadOnly    = attribute.Key("db.tx.read_only")
+	AttrTxIsolation   = attribute.Key("db.tx.isolation")
+	EventTxRetry      = "db.tx.retry"
+	AttrTxRetryReason = attribute.Key("db.tx.retry_reason")
+	AttrTxBackoffMS   = attribute.Key("db.tx.backoff_ms")
+)
+
+// キャッシュを使えずDBにフォールバックした際のスパンイベント
+const (
+	EventCacheFallback = "cache.fallback"
+	AttrFallbackReason = attribute.Key("cache.fallback_reason")
+)
+
+// 一覧取得リクエストの共通属性
+// 検索語そのものは個人情報を含みうるため長さのみを記録する
+func ListAttributes(page, pageSize int, search, sortField string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AttrListPage.Int(page),
+		AttrListPageSize.Int(pageSize),
+		AttrListSearchLen.Int(len([]rune(search))),
+		AttrListSortField.String(sortField),
+	}
+}
+
+// キャッシュのフォールバックをスパンイベントとして記録する
+func CacheFallback(span trace.Span, cache, reason string, err error) {
+	attrs := []attribute.KeyValue{AttrCacheName.String(cache), AttrFallbackReason.String(reason)}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.message", err.Error()))
+	}
+	span.AddEvent(EventCacheFallback, trace.WithAttributes(attrs...))
+}
+
+// エラーをスパンに記録し、ステータスをErrorにする
+// 見つからなかっただけ(sql.ErrNoRows)の場合は正常系として扱う
+func RecordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// エラーを記録してスパンを終了する
+// 名前付き戻り値のerrと組み合わせて defer func() { telemetry.End(span, err) }() のように使う
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
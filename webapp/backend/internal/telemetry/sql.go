@@ -2,7 +2,7 @@ package telemetry
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 
 	"github.com/XSAM/otelsql"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -18,7 +18,7 @@ func WrapSQLDriver(baseDriver string) string {
 		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true}),
 	)
 	if err != nil {
-		log.Printf("otelsql.Register failed, fallback to base driver: %v", err)
+		slog.Warn("otelsql.Register failed, falling back to base driver", slog.Any("error", err))
 		return baseDriver
 	}
 	return name
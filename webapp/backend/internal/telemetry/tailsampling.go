@@ -0,0 +1,242 @@
+package telemetry
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// テイルサンプリングの設定
+type tailSamplingConfig struct {
+	// エラーにも遅延にも該当しないトレースを残す割合
+	Ratio float64
+	// これ以上かかったリクエストのトレースは必ず残す
+	SlowThreshold time.Duration
+	// ルートパターン(http.route)ごとの遅延しきい値。SlowThresholdより優先する
+	RouteThresholds map[string]time.Duration
+	// 判定待ちでバッファするトレース数の上限。超えた場合は古いトレースから破棄する
+	MaxTraces int
+	// 1トレースあたりにバッファするスパン数の上限
+	MaxSpansPerTrace int
+}
+
+// 環境変数からテイルサンプリングの設定を読み込む
+//
+//	TRACE_SAMPLE_RATIO      エラー・遅延以外のトレースを残す割合 (デフォルト0.01)
+//	TRACE_SLOW_THRESHOLD    必ず残す遅延のしきい値 (デフォルト1s、0で無効)
+//	TRACE_SLOW_ROUTES       ルートごとのしきい値 (例: "/api/robot/delivery-plan=300ms,/api/v1/orders=2s")
+//	TRACE_TAIL_MAX_TRACES   判定待ちでバッファするトレース数の上限 (デフォルト10000)
+func tailSamplingConfigFromEnv() (tailSamplingConfig, error) {
+	ratio, _ := sampleRatioFromEnv()
+	cfg := tailSamplingConfig{
+		Ratio:           ratio,
+		SlowThreshold:   time.Second,
+		RouteThresholds: map[string]time.Duration{},
+	}
+	if v := os.Getenv("TRACE_SLOW_THRESHOLD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("TRACE_SLOW_THRESHOLD: %q is not a valid duration", v)
+		}
+		cfg.SlowThreshold = d
+	}
+	if v := os.Getenv("TRACE_SLOW_ROUTES"); v != "" {
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			route, value, ok := strings.Cut(item, "=")
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if !ok || err != nil || d < 0 || strings.TrimSpace(route) == "" {
+				return cfg, fmt.Errorf("TRACE_SLOW_ROUTES: %q must be route=duration", item)
+			}
+			cfg.RouteThresholds[strings.TrimSpace(route)] = d
+		}
+	}
+	if v := os.Getenv("TRACE_TAIL_MAX_TRACES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("TRACE_TAIL_MAX_TRACES: %q must be a positive integer", v)
+		}
+		cfg.MaxTraces = n
+	}
+	return cfg, nil
+}
+
+// 判定結果を覚えておくトレース数
+// ルートスパンの終了後に終わった非同期の子スパンも同じ判定に従わせるために使う
+const decidedCacheSize = 4096
+
+// ルートスパンが終わるまでトレース単位でスパンを溜め、残すかどうかをまとめて判定するプロセッサー
+//
+// 以下のいずれかに当てはまるトレースを次のプロセッサー(バッチ送信)に渡す:
+//   - いずれかのスパンのステータスがError
+//   - ルートスパンの所要時間がルートごと(なければ全体)のしきい値以上
+//   - トレースIDによる割合サンプリングに当たった
+//
+// 外部のコレクターを必要としないよう、判定はプロセス内で完結する。
+// ヘッドサンプリングで落とされたスパンはここに届かないため、AlwaysSampleと組み合わせること
+type tailSamplingProcessor struct {
+	next  sdktrace.SpanProcessor
+	cfg   tailSamplingConfig
+	ratio sdktrace.Sampler
+
+	mu      sync.Mutex
+	pending map[trace.TraceID]*pendingTrace
+	// 古い順に並んだ判定待ちトレースのID
+	order *list.List
+	// 判定済みトレースの結果 (decidedOrderは古い順)
+	decided      map[trace.TraceID]bool
+	decidedOrder *list.List
+}
+
+type pendingTrace struct {
+	spans   []sdktrace.ReadOnlySpan
+	errored bool
+	elem    *list.Element
+}
+
+func newTailSamplingProcessor(next sdktrace.SpanProcessor, cfg tailSamplingConfig) sdktrace.SpanProcessor {
+	if cfg.MaxTraces <= 0 {
+		cfg.MaxTraces = 10000
+	}
+	if cfg.MaxSpansPerTrace <= 0 {
+		cfg.MaxSpansPerTrace = 1000
+	}
+	return &tailSamplingProcessor{
+		next:         next,
+		cfg:          cfg,
+		ratio:        sdktrace.TraceIDRatioBased(cfg.Ratio),
+		pending:      make(map[trace.TraceID]*pendingTrace),
+		order:        list.New(),
+		decided:      make(map[trace.TraceID]bool),
+		decidedOrder: list.New(),
+	}
+}
+
+func (p *tailSamplingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *tailSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	traceID := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	// 判定済みのトレースに遅れて届いたスパンは同じ判定に従う
+	if keep, ok := p.decided[traceID]; ok {
+		p.mu.Unlock()
+		if keep {
+			p.next.OnEnd(s)
+		}
+		return
+	}
+
+	pt, ok := p.pending[traceID]
+	if !ok {
+		pt = &pendingTrace{}
+		pt.elem = p.order.PushBack(traceID)
+		p.pending[traceID] = pt
+		p.evictLocked()
+	}
+	if len(pt.spans) < p.cfg.MaxSpansPerTrace {
+		pt.spans = append(pt.spans, s)
+	}
+	if s.Status().Code == codes.Error {
+		pt.errored = true
+	}
+
+	if !isLocalRoot(s) {
+		p.mu.Unlock()
+		return
+	}
+
+	keep := pt.errored || p.isSlow(s) || p.sampledByRatio(s)
+	p.order.Remove(pt.elem)
+	delete(p.pending, traceID)
+	p.rememberLocked(traceID, keep)
+	p.mu.Unlock()
+
+	if keep {
+		for _, span := range pt.spans {
+			p.next.OnEnd(span)
+		}
+	}
+}
+
+func (p *tailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.pending = make(map[trace.TraceID]*pendingTrace)
+	p.order.Init()
+	p.mu.Unlock()
+	return p.next.Shutdown(ctx)
+}
+
+func (p *tailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// 上限を超えた判定待ちトレースを古い順に破棄する
+// ルートスパンが終わらないまま残ったトレースでメモリが膨らむのを防ぐ
+func (p *tailSamplingProcessor) evictLocked() {
+	for p.order.Len() > p.cfg.MaxTraces {
+		oldest := p.order.Front()
+		traceID := oldest.Value.(trace.TraceID)
+		p.order.Remove(oldest)
+		delete(p.pending, traceID)
+	}
+}
+
+func (p *tailSamplingProcessor) rememberLocked(traceID trace.TraceID, keep bool) {
+	p.decided[traceID] = keep
+	p.decidedOrder.PushBack(traceID)
+	for p.decidedOrder.Len() > decidedCacheSize {
+		oldest := p.decidedOrder.Front()
+		p.decidedOrder.Remove(oldest)
+		delete(p.decided, oldest.Value.(trace.TraceID))
+	}
+}
+
+func (p *tailSamplingProcessor) isSlow(root sdktrace.ReadOnlySpan) bool {
+	threshold := p.cfg.SlowThreshold
+	if route := routeOf(root); route != "" {
+		if t, ok := p.cfg.RouteThresholds[route]; ok {
+			threshold = t
+		}
+	}
+	return threshold > 0 && root.EndTime().Sub(root.StartTime()) >= threshold
+}
+
+func (p *tailSamplingProcessor) sampledByRatio(root sdktrace.ReadOnlySpan) bool {
+	res := p.ratio.ShouldSample(sdktrace.SamplingParameters{
+		TraceID: root.SpanContext().TraceID(),
+		Name:    root.Name(),
+	})
+	return res.Decision == sdktrace.RecordAndSample
+}
+
+// このプロセス内でのルートスパンか (親がない、または親が他サービスのスパン)
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	parent := s.Parent()
+	return !parent.IsValid() || parent.IsRemote()
+}
+
+// スパンのルートパターン (otelchiが付与するhttp.route属性、なければスパン名)
+func routeOf(s sdktrace.ReadOnlySpan) string {
+	for _, attr := range s.Attributes() {
+		if attr.Key == attribute.Key("http.route") {
+			return attr.Value.AsString()
+		}
+	}
+	return s.Name()
+}
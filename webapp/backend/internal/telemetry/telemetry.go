@@ -3,22 +3,35 @@ package telemetry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/jaeger"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const instrumentationName = "backend"
+
+// Initで設定したログプロバイダー (ログのエクスポートが無効な場合はnil)
+var loggerProvider *sdklog.LoggerProvider
+
+// トレースを有効にするか
 func enabled() bool {
 	if strings.EqualFold(os.Getenv("TRACE_ENABLED"), "false") {
 		return false
@@ -26,18 +39,39 @@ func enabled() bool {
 	if strings.EqualFold(os.Getenv("TRACE_ENABLED"), "true") {
 		return true
 	}
-	if os.Getenv("JAEGER_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+	if os.Getenv("JAEGER_ENDPOINT") != "" || otlpEndpoint("TRACES") != "" {
 		return true
 	}
 	return false
 }
 
-func samplerFromEnv() sdktrace.Sampler {
+// メトリクス・ログをOTLPでエクスポートするか
+// OTEL_METRICS_EXPORTER / OTEL_LOGS_EXPORTER に "otlp" か "none" を指定する。
+// 未指定の場合はOTLPのエンドポイントが設定されていればエクスポートする
+func signalEnabled(exporterKey, signal string) bool {
+	switch strings.ToLower(os.Getenv(exporterKey)) {
+	case "none":
+		return false
+	case "otlp":
+		return true
+	}
+	return otlpEndpoint(signal) != ""
+}
+
+// ヘッドサンプリング・テイルサンプリング共通のサンプリング割合
+func sampleRatioFromEnv() (float64, bool) {
 	if r := os.Getenv("TRACE_SAMPLE_RATIO"); r != "" {
 		if v, err := strconv.ParseFloat(r, 64); err == nil {
-			return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(v))
+			return v, true
 		}
 	}
+	return 0.01, false
+}
+
+func samplerFromEnv() sdktrace.Sampler {
+	if v, ok := sampleRatioFromEnv(); ok {
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(v))
+	}
 	switch strings.ToLower(os.Getenv("OTEL_TRACES_SAMPLER")) {
 	case "always_off":
 		return sdktrace.NeverSample()
@@ -47,7 +81,7 @@ func samplerFromEnv() sdktrace.Sampler {
 	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.01))
 }
 
-func resourceFromEnv() *resource.Resource {
+func resourceFromEnv(ctx context.Context) *resource.Resource {
 	svc := os.Getenv("SERVICE_NAME")
 	if svc == "" {
 		svc = "backend"
@@ -59,51 +93,172 @@ func resourceFromEnv() *resource.Resource {
 			env = "local"
 		}
 	}
-	r, _ := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName(svc),
-			attribute.String("deployment.environment", env),
-		),
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(svc),
+		attribute.String("deployment.environment", env),
+	}
+	if v := os.Getenv("SERVICE_VERSION"); v != "" {
+		attrs = append(attrs, semconv.ServiceVersion(v))
+	}
+	// OTEL_RESOURCE_ATTRIBUTES / OTEL_SERVICE_NAME が指定されていればそちらを優先する
+	// 一部の検出に失敗した場合も、取得できた属性はそのまま使う
+	r, _ := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
 	)
 	return r
 }
 
+// トレース・メトリクス・ログのプロバイダーを環境変数に従って設定する
+//
+// 返り値のshutdownは常に非nilで、設定できたプロバイダーのみをフラッシュして停止する。
+// 一部のシグナルの設定に失敗した場合もそのシグナルを無効にして続行し、エラーをまとめて返す
 func Init(ctx context.Context) (func(context.Context) error, error) {
-	if !enabled() {
-		otel.SetTracerProvider(trace.NewNoopTracerProvider())
-		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-			propagation.TraceContext{}, propagation.Baggage{},
-		))
-		return func(context.Context) error { return nil }, nil
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var (
+		shutdowns []func(context.Context) error
+		errs      []error
+	)
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range shutdowns {
+			errs = append(errs, fn(ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, signal := range []string{"TRACES", "METRICS", "LOGS"} {
+		if p := otlpProtocol(signal); p != protocolHTTP && p != protocolGRPC {
+			return shutdown, fmt.Errorf("telemetry: unsupported OTLP protocol %q for %s (use %s or %s)",
+				p, strings.ToLower(signal), protocolHTTP, protocolGRPC)
+		}
+	}
+
+	res := resourceFromEnv(ctx)
+
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	if enabled() {
+		tp, err := initTracerProvider(ctx, res)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("telemetry: traces: %w", err))
+		} else {
+			shutdowns = append(shutdowns, tp.Shutdown)
+		}
 	}
 
+	if signalEnabled("OTEL_METRICS_EXPORTER", "METRICS") {
+		mp, err := initMeterProvider(ctx, res)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("telemetry: metrics: %w", err))
+		} else {
+			shutdowns = append(shutdowns, mp.Shutdown)
+		}
+	}
+
+	if signalEnabled("OTEL_LOGS_EXPORTER", "LOGS") {
+		lp, err := initLoggerProvider(ctx, res)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("telemetry: logs: %w", err))
+		} else {
+			shutdowns = append(shutdowns, lp.Shutdown)
+		}
+	}
+
+	return shutdown, errors.Join(errs...)
+}
+
+func initTracerProvider(ctx context.Context, res *resource.Resource) (*sdktrace.TracerProvider, error) {
 	var (
 		exp sdktrace.SpanExporter
 		err error
 	)
 	if ep := os.Getenv("JAEGER_ENDPOINT"); ep != "" {
 		exp, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(ep)))
-	} else if ep := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); ep != "" {
-		exp, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(ep), otlptracehttp.WithInsecure())
+	} else if otlpEndpoint("TRACES") != "" {
+		exp, err = newTraceExporter(ctx)
+	} else {
+		err = errors.New("TRACE_ENABLED is set but neither JAEGER_ENDPOINT nor OTEL_EXPORTER_OTLP_ENDPOINT is configured")
 	}
-	if err != nil || exp == nil {
-		otel.SetTracerProvider(trace.NewNoopTracerProvider())
-		return func(context.Context) error { return nil }, nil
+	if err != nil {
+		return nil, err
 	}
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(samplerFromEnv()),
-		sdktrace.WithBatcher(exp,
-			sdktrace.WithMaxQueueSize(4096),
-			sdktrace.WithExportTimeout(5*time.Second),
-		),
-		sdktrace.WithResource(resourceFromEnv()),
+	batcher := sdktrace.NewBatchSpanProcessor(exp,
+		sdktrace.WithMaxQueueSize(4096),
+		sdktrace.WithExportTimeout(5*time.Second),
 	)
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+	switch mode := strings.ToLower(os.Getenv("TRACE_SAMPLING")); mode {
+	case "", "head":
+		opts = append(opts,
+			sdktrace.WithSampler(samplerFromEnv()),
+			sdktrace.WithSpanProcessor(batcher),
+		)
+	case "tail":
+		cfg, err := tailSamplingConfigFromEnv()
+		if err != nil {
+			_ = batcher.Shutdown(ctx)
+			return nil, err
+		}
+		// 判定はトレースが終わってから行うため、全てのスパンを記録する
+		opts = append(opts,
+			sdktrace.WithSampler(sdktrace.AlwaysSample()),
+			sdktrace.WithSpanProcessor(newTailSamplingProcessor(batcher, cfg)),
+		)
+	default:
+		_ = batcher.Shutdown(ctx)
+		return nil, fmt.Errorf("TRACE_SAMPLING: %q must be head or tail", mode)
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{}, propagation.Baggage{},
-	))
-	return tp.Shutdown, nil
+	return tp, nil
+}
+
+// 送信間隔はOTEL_METRIC_EXPORT_INTERVAL (ミリ秒、デフォルト60秒) で変更できる
+func initMeterProvider(ctx context.Context, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
+	exp, err := newMetricExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp)),
+		sdkmetric.WithResource(res),
+	)
+	// GC・ゴルーチン数などのランタイムメトリクス
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		_ = mp.Shutdown(ctx)
+		return nil, err
+	}
+	otel.SetMeterProvider(mp)
+	return mp, nil
+}
+
+func initLoggerProvider(ctx context.Context, res *resource.Resource) (*sdklog.LoggerProvider, error) {
+	exp, err := newLogExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+		sdklog.WithResource(res),
+	)
+	global.SetLoggerProvider(lp)
+	loggerProvider = lp
+	return lp, nil
+}
+
+// slogのログをOTLPに送るハンドラー
+// Initでログのエクスポートが有効になっていない場合はnilを返す
+func LogHandler() slog.Handler {
+	if loggerProvider == nil {
+		return nil
+	}
+	return otelslog.NewHandler(instrumentationName, otelslog.WithLoggerProvider(loggerProvider))
 }
@@ -0,0 +1,183 @@
+// サービス・リポジトリが出力するスパンを検証するためのハーネス
+//
+// グローバルのTracerProviderをインメモリのSpanRecorderに差し替え、
+// 終了したスパンの名前・属性・イベント・ステータスを検査する。
+//
+//	rec := telemetrytest.Install()
+//	defer rec.Close()
+//	products, _, err := repo.ListProducts(ctx, userID, req)
+//	err = rec.Assert("CachingProductRepository.ListProducts",
+//		telemetrytest.HasBool(telemetry.AttrCacheHit, false))
+package telemetrytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Recorder struct {
+	spans *tracetest.SpanRecorder
+	tp    *sdktrace.TracerProvider
+	prev  trace.TracerProvider
+}
+
+// 全てのスパンを記録するTracerProviderをグローバルに設定する
+// 終了後はCloseで元のプロバイダーに戻すこと
+func Install() *Recorder {
+	spans := tracetest.NewSpanRecorder()
+	r := &Recorder{
+		spans: spans,
+		tp: sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(sdktrace.AlwaysSample()),
+			sdktrace.WithSpanProcessor(spans),
+		),
+		prev: otel.GetTracerProvider(),
+	}
+	otel.SetTracerProvider(r.tp)
+	return r
+}
+
+// 元のTracerProviderに戻す
+func (r *Recorder) Close() {
+	otel.SetTracerProvider(r.prev)
+	_ = r.tp.Shutdown(context.Background())
+}
+
+// 終了したスパンの一覧
+func (r *Recorder) Ended() []sdktrace.ReadOnlySpan {
+	return r.spans.Ended()
+}
+
+// 名前が一致する終了済みのスパンを全て返す
+func (r *Recorder) FindAll(name string) []sdktrace.ReadOnlySpan {
+	var found []sdktrace.ReadOnlySpan
+	for _, s := range r.spans.Ended() {
+		if s.Name() == name {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// 名前が一致する最後に終了したスパンを返す
+func (r *Recorder) Find(name string) (sdktrace.ReadOnlySpan, bool) {
+	found := r.FindAll(name)
+	if len(found) == 0 {
+		return nil, false
+	}
+	return found[len(found)-1], true
+}
+
+// スパンに対する検査
+type Check func(sdktrace.ReadOnlySpan) error
+
+// 名前が一致する最後のスパンが全ての検査を満たすことを確認する
+// 満たさない検査はまとめてエラーとして返す
+func (r *Recorder) Assert(name string, checks ...Check) error {
+	span, ok := r.Find(name)
+	if !ok {
+		return fmt.Errorf("span %q not recorded (recorded: %s)", name, strings.Join(r.names(), ", "))
+	}
+	var errs []error
+	for _, check := range checks {
+		if err := check(span); err != nil {
+			errs = append(errs, fmt.Errorf("span %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) names() []string {
+	var names []string
+	for _, s := range r.spans.Ended() {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// 属性が指定の値であること
+func HasAttr(kv attribute.KeyValue) Check {
+	return func(s sdktrace.ReadOnlySpan) error {
+		for _, attr := range s.Attributes() {
+			if attr.Key != kv.Key {
+				continue
+			}
+			if attr.Value != kv.Value {
+				return fmt.Errorf("attribute %s = %s, want %s", kv.Key, attr.Value.Emit(), kv.Value.Emit())
+			}
+			return nil
+		}
+		return fmt.Errorf("attribute %s not set", kv.Key)
+	}
+}
+
+func HasInt(key attribute.Key, want int) Check {
+	return HasAttr(key.Int(want))
+}
+
+func HasBool(key attribute.Key, want bool) Check {
+	return HasAttr(key.Bool(want))
+}
+
+func HasString(key attribute.Key, want string) Check {
+	return HasAttr(key.String(want))
+}
+
+// 属性が設定されていること (値は問わない)
+func HasKey(key attribute.Key) Check {
+	return func(s sdktrace.ReadOnlySpan) error {
+		for _, attr := range s.Attributes() {
+			if attr.Key == key {
+				return nil
+			}
+		}
+		return fmt.Errorf("attribute %s not set", key)
+	}
+}
+
+// 指定の名前のイベントが記録されていること
+func HasEvent(name string) Check {
+	return func(s sdktrace.ReadOnlySpan) error {
+		for _, e := range s.Events() {
+			if e.Name == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("event %q not recorded", name)
+	}
+}
+
+// ステータスコードが一致すること
+func HasStatus(code codes.Code) Check {
+	return func(s sdktrace.ReadOnlySpan) error {
+		if got := s.Status().Code; got != code {
+			return fmt.Errorf("status = %s, want %s", got, code)
+		}
+		return nil
+	}
+}
+
+// 親スパンの名前が一致すること
+func HasParent(r *Recorder, parentName string) Check {
+	return func(s sdktrace.ReadOnlySpan) error {
+		parentID := s.Parent().SpanID()
+		for _, p := range r.spans.Ended() {
+			if p.SpanContext().SpanID() == parentID {
+				if p.Name() != parentName {
+					return fmt.Errorf("parent = %q, want %q", p.Name(), parentName)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("parent %q not recorded", parentName)
+	}
+}
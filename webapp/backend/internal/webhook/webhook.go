@@ -0,0 +1,123 @@
+// Webhookの署名と送信用のHTTPクライアント
+//
+// 署名はX-Webhook-Signatureヘッダーに t={UNIX秒},v1={HMAC-SHA256} の形式で付与する。
+// HMACの対象は "{t}.{リクエストボディ}" で、受信側はVerifyで検証できる。
+// タイムスタンプを含めているため、古いリクエストの再送(リプレイ)を受信側で拒否できる
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 送信時に付与するヘッダー
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+var (
+	// 署名ヘッダーの形式が不正、または署名が一致しない
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// 署名のタイムスタンプが許容範囲外
+	ErrSignatureExpired = errors.New("webhook signature timestamp out of tolerance")
+	// 送信先がプライベートネットワークのアドレスに解決された
+	ErrPrivateTarget = errors.New("webhook target resolves to a private address")
+)
+
+// 署名ヘッダーの値を返す
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+// 署名ヘッダーを検証する
+// タイムスタンプがnowからtolerance以上ずれている場合はErrSignatureExpiredを返す
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return ErrSignatureExpired
+	}
+	expected := mac(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Webhookの送信に使うHTTPクライアント
+//
+// リダイレクトには従わない。allowPrivateがfalseの場合、ループバック・プライベート・
+// リンクローカルのアドレスへの接続を拒否する (Webhookを使ってDBやRedisなど内部のサービスに
+// リクエストを送らせないため)。判定は名前解決後の接続先アドレスで行う
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isPrivate(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
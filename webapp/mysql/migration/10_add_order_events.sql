@@ -0,0 +1,16 @@
+-- 注文ステータスの変更履歴 (誰が・いつ・どのステータスからどのステータスに変えたか)
+-- ステータスの更新と同じトランザクションで書き込む。このマイグレーション以前の変更は記録されていない
+CREATE TABLE order_events (
+    event_id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    order_id INT UNSIGNED NOT NULL,
+    event_type VARCHAR(32) NOT NULL,
+    from_status VARCHAR(50) NULL,
+    to_status VARCHAR(50) NOT NULL,
+    actor_type VARCHAR(16) NOT NULL,
+    actor_id VARCHAR(64) NOT NULL,
+    plan_id CHAR(36) NULL,
+    occurred_at DATETIME(6) NOT NULL,
+    KEY idx_order_events_order (order_id, event_id),
+    KEY idx_order_events_plan (plan_id),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+-- 配送計画 (配送統計のロボット別の稼働率に使う)
+-- 注文を含む計画のみ、注文のステータス更新と同じトランザクションで記録する
+CREATE TABLE delivery_plans (
+    plan_id CHAR(36) PRIMARY KEY,
+    robot_id VARCHAR(64) NOT NULL,
+    capacity INT UNSIGNED NOT NULL,
+    total_weight INT UNSIGNED NOT NULL,
+    total_value INT UNSIGNED NOT NULL,
+    order_count INT UNSIGNED NOT NULL,
+    created_at DATETIME NOT NULL,
+    KEY idx_delivery_plans_created (created_at, robot_id)
+);
+
+-- 配送統計の集計用のインデックス
+-- 統計は全ユーザーの注文を期間で集計するため、日時を先頭にしてインデックスだけで集計できるようにしている
+CREATE INDEX idx_orders_created_status_product ON orders(created_at, shipped_status, product_id);
+CREATE INDEX idx_orders_arrived_created ON orders(arrived_at, created_at);
+CREATE INDEX idx_order_events_type_occurred ON order_events(event_type, occurred_at, actor_type, actor_id);
@@ -0,0 +1,6 @@
+-- ユーザー管理API用: ロール列の追加とユーザー名の一意制約
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'store_manager';
+
+-- 5_で作成した非ユニークインデックスをユニークインデックスに置き換える
+DROP INDEX idx_users_user_name ON users;
+CREATE UNIQUE INDEX uq_users_user_name ON users(user_name);
@@ -0,0 +1,5 @@
+-- 注文履歴の絞り込み(ステータス・商品・日時範囲)用の複合インデックス
+-- 注文履歴は常にuser_idで絞り込むため、user_idを先頭にしている
+CREATE INDEX idx_orders_user_status_created ON orders(user_id, shipped_status, created_at);
+CREATE INDEX idx_orders_user_product_created ON orders(user_id, product_id, created_at);
+CREATE INDEX idx_orders_user_arrived ON orders(user_id, arrived_at);
@@ -0,0 +1,33 @@
+-- 注文のライフサイクルイベントを店舗システムに通知するWebhook
+-- 署名に使うため、シークレットはハッシュ化せずに保存する
+CREATE TABLE webhooks (
+    webhook_id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT UNSIGNED NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    event_types VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME NOT NULL,
+    KEY idx_webhooks_user_id (user_id, active),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- 送信待ちのイベント(アウトボックス)と送信履歴
+-- 注文の更新と同じトランザクションで書き込み、配信ワーカーが送信する
+CREATE TABLE webhook_deliveries (
+    delivery_id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    webhook_id BIGINT UNSIGNED NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_status_code INT NULL,
+    last_error VARCHAR(1024) NULL,
+    created_at DATETIME NOT NULL,
+    delivered_at DATETIME NULL,
+    KEY idx_webhook_deliveries_due (status, next_attempt_at),
+    KEY idx_webhook_deliveries_webhook (webhook_id, delivery_id),
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(webhook_id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- 10_add_order_events.sql のロールバック
+DROP TABLE order_events;
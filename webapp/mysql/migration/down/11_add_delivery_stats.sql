@@ -0,0 +1,5 @@
+-- 11_add_delivery_stats.sql のロールバック
+DROP INDEX idx_order_events_type_occurred ON order_events;
+DROP INDEX idx_orders_arrived_created ON orders;
+DROP INDEX idx_orders_created_status_product ON orders;
+DROP TABLE delivery_plans;
@@ -0,0 +1,5 @@
+-- 6_add_user_roles.sql のロールバック
+DROP INDEX uq_users_user_name ON users;
+CREATE INDEX idx_users_user_name ON users(user_name);
+
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,2 @@
+-- 7_add_api_tokens.sql のロールバック
+DROP TABLE api_tokens;
@@ -0,0 +1,4 @@
+-- 8_add_order_filter_indexes.sql のロールバック
+DROP INDEX idx_orders_user_status_created ON orders;
+DROP INDEX idx_orders_user_product_created ON orders;
+DROP INDEX idx_orders_user_arrived ON orders;
@@ -0,0 +1,3 @@
+-- 9_add_webhooks.sql のロールバック
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;